@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditEvent describes a single authentication or token lifecycle event.
+type AuditEvent struct {
+	Time time.Time
+	// Type identifies what happened, e.g. "local.login", "local.refresh",
+	// "connector.open".
+	Type string
+
+	Subject     string
+	ConnectorID string
+	ClientID    string
+	Scopes      []string
+	IP          string
+	UserAgent   string
+
+	Success bool
+	// ErrorClass is a short, stable identifier for the failure (e.g.
+	// "invalid_credentials", "open_error"). Empty on success.
+	ErrorClass string
+}
+
+// AuditSink receives audit events emitted by the server. Emit must not
+// block the caller for any meaningful length of time; sinks that perform
+// I/O should buffer internally. The server always wraps the configured
+// AuditSink so that a slow or stuck sink can't stall the auth path.
+type AuditSink interface {
+	Emit(ctx context.Context, event AuditEvent)
+}
+
+type noopAuditSink struct{}
+
+func (noopAuditSink) Emit(context.Context, AuditEvent) {}
+
+// auditQueueSize is the number of events buffered between the request path
+// and the configured AuditSink before events start getting dropped.
+const auditQueueSize = 256
+
+type auditJob struct {
+	event AuditEvent
+}
+
+// asyncAuditSink runs a single worker goroutine that drains events to the
+// wrapped sink, so Emit itself never blocks on sink I/O. If the sink falls
+// behind, new events are dropped rather than queued unboundedly.
+type asyncAuditSink struct {
+	sink    AuditSink
+	events  chan auditJob
+	dropped prometheus.Counter
+	logger  logrus.FieldLogger
+}
+
+func newAsyncAuditSink(sink AuditSink, dropped prometheus.Counter, logger logrus.FieldLogger) *asyncAuditSink {
+	a := &asyncAuditSink{
+		sink:    sink,
+		events:  make(chan auditJob, auditQueueSize),
+		dropped: dropped,
+		logger:  logger,
+	}
+	go a.run()
+	return a
+}
+
+// run drains queued events to the wrapped sink using a context of its own
+// rather than the caller's: by the time an event reaches here, the request
+// that queued it has very likely already returned and canceled its
+// context, which would otherwise make every delivery (and retry) fail
+// immediately against an already-done context.
+func (a *asyncAuditSink) run() {
+	for job := range a.events {
+		a.sink.Emit(context.Background(), job.event)
+	}
+}
+
+// Emit implements AuditSink. ctx is accepted to satisfy the AuditSink
+// interface but isn't propagated to the wrapped sink; see run.
+func (a *asyncAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	select {
+	case a.events <- auditJob{event}:
+	default:
+		if a.dropped != nil {
+			a.dropped.Inc()
+		}
+		a.logger.Errorf("audit sink queue full, dropping %s event for subject %q", event.Type, event.Subject)
+	}
+}
+
+// emitAudit is a convenience wrapper for call sites that don't have an
+// AuditEvent fully built yet; it stamps Time from s.now before emitting.
+func (s *Server) emitAudit(ctx context.Context, event AuditEvent) {
+	event.Time = s.now()
+	s.audit.Emit(ctx, event)
+}
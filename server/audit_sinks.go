@@ -0,0 +1,234 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// newEventID returns a random, URL-safe identifier suitable for a
+// CloudEvents "id" field.
+func newEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// cloudEvent is the minimal CloudEvents v1.0 JSON envelope used by the
+// built-in AuditSink implementations.
+type cloudEvent struct {
+	SpecVersion string     `json:"specversion"`
+	ID          string     `json:"id"`
+	Source      string     `json:"source"`
+	Type        string     `json:"type"`
+	Time        time.Time  `json:"time"`
+	DataCtype   string     `json:"datacontenttype"`
+	Data        AuditEvent `json:"data"`
+}
+
+func toCloudEvent(source string, event AuditEvent) cloudEvent {
+	return cloudEvent{
+		SpecVersion: "1.0",
+		ID:          newEventID(),
+		Source:      source,
+		Type:        "io.dex." + event.Type,
+		Time:        event.Time,
+		DataCtype:   "application/json",
+		Data:        event,
+	}
+}
+
+// WriterAuditSink writes CloudEvents-formatted JSON, one event per line, to
+// an io.Writer. It's the basis for the stdout and file sinks below.
+type WriterAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	source string
+}
+
+// NewWriterAuditSink returns an AuditSink that writes newline-delimited
+// CloudEvents JSON to w. source populates the CloudEvents "source" field,
+// typically the issuer URL.
+func NewWriterAuditSink(w io.Writer, source string) *WriterAuditSink {
+	return &WriterAuditSink{w: w, source: source}
+}
+
+// Emit implements AuditSink.
+func (w *WriterAuditSink) Emit(_ context.Context, event AuditEvent) {
+	b, err := json.Marshal(toCloudEvent(w.source, event))
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.w.Write(b)
+}
+
+// NewStdoutAuditSink returns an AuditSink that writes CloudEvents JSON to
+// os.Stdout.
+func NewStdoutAuditSink(source string) *WriterAuditSink {
+	return NewWriterAuditSink(os.Stdout, source)
+}
+
+// FileAuditSink writes CloudEvents JSON to a file, rotating it once it
+// exceeds maxSizeBytes. Only the current and previous file are kept.
+type FileAuditSink struct {
+	mu           sync.Mutex
+	path         string
+	maxSizeBytes int64
+	source       string
+
+	f    *os.File
+	size int64
+}
+
+// NewFileAuditSink returns an AuditSink that appends CloudEvents JSON lines
+// to path, rotating to path+".1" once the file reaches maxSizeBytes.
+func NewFileAuditSink(path string, maxSizeBytes int64, source string) (*FileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("stat audit log: %v", err)
+	}
+	return &FileAuditSink{
+		path:         path,
+		maxSizeBytes: maxSizeBytes,
+		source:       source,
+		f:            f,
+		size:         info.Size(),
+	}, nil
+}
+
+func (s *FileAuditSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	s.f = f
+	s.size = 0
+	return nil
+}
+
+// Emit implements AuditSink.
+func (s *FileAuditSink) Emit(_ context.Context, event AuditEvent) {
+	b, err := json.Marshal(toCloudEvent(s.source, event))
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxSizeBytes > 0 && s.size+int64(len(b)) > s.maxSizeBytes {
+		if err := s.rotate(); err != nil {
+			// Best effort: keep writing to the oversized file rather than
+			// lose the event entirely.
+			f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				return
+			}
+			s.f = f
+		}
+	}
+	n, err := s.f.Write(b)
+	if err == nil {
+		s.size += int64(n)
+	}
+}
+
+// Close closes the underlying file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
+
+// WebhookAuditSink POSTs CloudEvents JSON to an HTTP endpoint, retrying
+// with exponential backoff on failure. Because AuditSink.Emit must not
+// block, callers should wrap this in the server's internal async sink
+// (which they get automatically via Config.AuditSink) rather than call it
+// synchronously from a hot path.
+type WebhookAuditSink struct {
+	url        string
+	client     *http.Client
+	source     string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewWebhookAuditSink returns an AuditSink that delivers events to url via
+// HTTP POST, retrying up to maxRetries times with exponential backoff
+// starting at backoff.
+func NewWebhookAuditSink(url string, client *http.Client, source string, maxRetries int, backoff time.Duration) *WebhookAuditSink {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &WebhookAuditSink{
+		url:        url,
+		client:     client,
+		source:     source,
+		maxRetries: maxRetries,
+		backoff:    backoff,
+	}
+}
+
+// Emit implements AuditSink. It blocks for the duration of the HTTP
+// request (and any retries), so it's expected to run behind the server's
+// async sink wrapper rather than be called directly from a handler.
+func (s *WebhookAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	b, err := json.Marshal(toCloudEvent(s.source, event))
+	if err != nil {
+		return
+	}
+
+	delay := s.backoff
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		req = req.WithContext(ctx)
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 500 {
+			return
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// blockingAuditSink blocks in Emit until released, so tests can force
+// asyncAuditSink's queue to fill up.
+type blockingAuditSink struct {
+	release chan struct{}
+	got     chan AuditEvent
+}
+
+func (b *blockingAuditSink) Emit(ctx context.Context, event AuditEvent) {
+	<-b.release
+	b.got <- event
+}
+
+// TestAsyncAuditSinkDropsWhenFull verifies that Emit never blocks the
+// caller: once the queue is full, further events are dropped and counted
+// instead of piling up unboundedly.
+func TestAsyncAuditSinkDropsWhenFull(t *testing.T) {
+	sink := &blockingAuditSink{release: make(chan struct{}), got: make(chan AuditEvent, 1)}
+	logger := logrus.New()
+	logger.SetOutput(new(bytes.Buffer))
+
+	a := newAsyncAuditSink(sink, nil, logger)
+
+	// The first event is picked up by the worker and blocks there,
+	// leaving the full auditQueueSize buffer free to fill up behind it.
+	a.Emit(context.Background(), AuditEvent{Type: "first"})
+	for i := 0; i < auditQueueSize; i++ {
+		a.Emit(context.Background(), AuditEvent{Type: "queued"})
+	}
+
+	// The queue is now full; this one must be dropped rather than block.
+	done := make(chan struct{})
+	go func() {
+		a.Emit(context.Background(), AuditEvent{Type: "overflow"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Emit blocked instead of dropping the event once the queue was full")
+	}
+
+	close(sink.release)
+	<-sink.got
+}
+
+// TestAsyncAuditSinkDropCounterNilSafe verifies that Emit doesn't panic
+// when no Prometheus counter was wired in, which is the configuration
+// newServer uses when Config.PrometheusRegistry is nil.
+func TestAsyncAuditSinkDropCounterNilSafe(t *testing.T) {
+	a := &asyncAuditSink{
+		sink:   noopAuditSink{},
+		events: make(chan auditJob), // unbuffered with no worker reading it: every send takes the drop path
+		logger: logrus.New(),
+	}
+	a.Emit(context.Background(), AuditEvent{Type: "drop-me"})
+}
+
+// TestWriterAuditSinkEmit verifies that WriterAuditSink writes one
+// CloudEvents JSON object per line, populated from the AuditEvent.
+func TestWriterAuditSinkEmit(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterAuditSink(&buf, "https://dex.example.com")
+
+	sink.Emit(context.Background(), AuditEvent{Type: "auth.success", Subject: "user@example.com"})
+	sink.Emit(context.Background(), AuditEvent{Type: "auth.failure", Subject: "other@example.com"})
+
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), buf.String())
+	}
+
+	var ev cloudEvent
+	if err := json.Unmarshal([]byte(lines[0]), &ev); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if ev.Type != "io.dex.auth.success" || ev.Source != "https://dex.example.com" || ev.Data.Subject != "user@example.com" {
+		t.Errorf("decoded event = %+v, want type io.dex.auth.success, source https://dex.example.com, subject user@example.com", ev)
+	}
+}
+
+// TestFileAuditSinkRotates verifies that FileAuditSink rotates to path+".1"
+// once maxSizeBytes is exceeded, and keeps writing afterward.
+func TestFileAuditSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	// Small enough that a single event's JSON line trips rotation.
+	sink, err := NewFileAuditSink(path, 1, "https://dex.example.com")
+	if err != nil {
+		t.Fatalf("NewFileAuditSink: %v", err)
+	}
+	defer sink.Close()
+
+	sink.Emit(context.Background(), AuditEvent{Type: "first"})
+	sink.Emit(context.Background(), AuditEvent{Type: "second"})
+
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Fatalf("expected rotated file %s.1 to exist: %v", path, err)
+	}
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("read rotated file: %v", err)
+	}
+	if !strings.Contains(string(rotated), `"first"`) {
+		t.Errorf("rotated file = %q, want it to contain the first event", rotated)
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read current file: %v", err)
+	}
+	if !strings.Contains(string(current), `"second"`) {
+		t.Errorf("current file = %q, want it to contain the second event", current)
+	}
+}
+
+// TestWebhookAuditSinkRetries verifies that WebhookAuditSink retries on a
+// 5xx response, up to maxRetries times, and gives up on the first 2xx.
+func TestWebhookAuditSinkRetries(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookAuditSink(srv.URL, srv.Client(), "https://dex.example.com", 5, time.Millisecond)
+	sink.Emit(context.Background(), AuditEvent{Type: "auth.success"})
+
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3 (2 failures then a success)", attempts)
+	}
+}
+
+// TestWebhookAuditSinkGivesUpAfterMaxRetries verifies that a persistently
+// failing endpoint doesn't retry forever.
+func TestWebhookAuditSinkGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sink := NewWebhookAuditSink(srv.URL, srv.Client(), "https://dex.example.com", 2, time.Millisecond)
+	sink.Emit(context.Background(), AuditEvent{Type: "auth.success"})
+
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3 (1 initial try + 2 retries)", attempts)
+	}
+}
+
+// TestWebhookAuditSinkRespectsContextCancellation verifies that a canceled
+// context stops the retry loop instead of waiting out the full backoff.
+func TestWebhookAuditSinkRespectsContextCancellation(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sink := NewWebhookAuditSink(srv.URL, srv.Client(), "https://dex.example.com", 5, time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		sink.Emit(ctx, AuditEvent{Type: "auth.success"})
+		close(done)
+	}()
+
+	// Let the first attempt land, then cancel before the (long) backoff
+	// would otherwise elapse.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Emit did not return promptly after its context was canceled")
+	}
+	if attempts != 1 {
+		t.Errorf("got %d attempts, want 1 before cancellation was observed", attempts)
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// decodeCBOR decodes a single, definite-length-encoded CBOR value from b,
+// returning the value and the number of bytes consumed.
+//
+// This is not a general-purpose CBOR decoder: it implements just enough of
+// RFC 7049 to parse the attestationObject and authenticator data structures
+// WebAuthn ceremonies exchange, which browsers and authenticators always
+// encode using definite lengths. Maps decode to map[interface{}]interface{},
+// arrays to []interface{}, byte/text strings to []byte/string, and
+// integers to int64.
+func decodeCBOR(b []byte) (interface{}, int, error) {
+	if len(b) == 0 {
+		return nil, 0, fmt.Errorf("cbor: unexpected end of input")
+	}
+
+	major := b[0] >> 5
+	info := b[0] & 0x1f
+
+	length, headerLen, err := cborLength(b, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0: // unsigned int
+		return int64(length), headerLen, nil
+	case 1: // negative int
+		return -1 - int64(length), headerLen, nil
+	case 2: // byte string
+		n, err := boundedLength(length, len(b)-headerLen)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cbor: byte string: %v", err)
+		}
+		end := headerLen + n
+		return append([]byte(nil), b[headerLen:end]...), end, nil
+	case 3: // text string
+		n, err := boundedLength(length, len(b)-headerLen)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cbor: text string: %v", err)
+		}
+		end := headerLen + n
+		return string(b[headerLen:end]), end, nil
+	case 4: // array
+		n, err := boundedLength(length, len(b)-headerLen)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cbor: array: %v", err)
+		}
+		out := make([]interface{}, 0, n)
+		off := headerLen
+		for i := 0; i < n; i++ {
+			v, n, err := decodeCBOR(b[off:])
+			if err != nil {
+				return nil, 0, err
+			}
+			out = append(out, v)
+			off += n
+		}
+		return out, off, nil
+	case 5: // map
+		n, err := boundedLength(length, len(b)-headerLen)
+		if err != nil {
+			return nil, 0, fmt.Errorf("cbor: map: %v", err)
+		}
+		out := make(map[interface{}]interface{}, n)
+		off := headerLen
+		for i := 0; i < n; i++ {
+			k, n, err := decodeCBOR(b[off:])
+			if err != nil {
+				return nil, 0, err
+			}
+			off += n
+			v, n, err := decodeCBOR(b[off:])
+			if err != nil {
+				return nil, 0, err
+			}
+			off += n
+			out[k] = v
+		}
+		return out, off, nil
+	case 6: // tag: skip the tag, decode the tagged value
+		v, n, err := decodeCBOR(b[headerLen:])
+		if err != nil {
+			return nil, 0, err
+		}
+		return v, headerLen + n, nil
+	case 7: // simple/float
+		switch info {
+		case 20:
+			return false, headerLen, nil
+		case 21:
+			return true, headerLen, nil
+		case 22, 23:
+			return nil, headerLen, nil
+		default:
+			return nil, 0, fmt.Errorf("cbor: unsupported simple/float value (info=%d)", info)
+		}
+	default:
+		return nil, 0, fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+}
+
+// cborLength parses the length/value field following the initial byte,
+// returning the value and the total number of header bytes consumed
+// (including the initial byte).
+func cborLength(b []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(b) < 2 {
+			return 0, 0, fmt.Errorf("cbor: truncated 1-byte length")
+		}
+		return uint64(b[1]), 2, nil
+	case info == 25:
+		if len(b) < 3 {
+			return 0, 0, fmt.Errorf("cbor: truncated 2-byte length")
+		}
+		return uint64(binary.BigEndian.Uint16(b[1:3])), 3, nil
+	case info == 26:
+		if len(b) < 5 {
+			return 0, 0, fmt.Errorf("cbor: truncated 4-byte length")
+		}
+		return uint64(binary.BigEndian.Uint32(b[1:5])), 5, nil
+	case info == 27:
+		if len(b) < 9 {
+			return 0, 0, fmt.Errorf("cbor: truncated 8-byte length")
+		}
+		return binary.BigEndian.Uint64(b[1:9]), 9, nil
+	default:
+		return 0, 0, fmt.Errorf("cbor: indefinite-length items are not supported")
+	}
+}
+
+// boundedLength converts an attacker-controlled CBOR length into an int,
+// rejecting it if it exceeds remaining, the number of bytes left in the
+// input. Every use of length below (a byte count for strings, an element or
+// pair count for arrays/maps) consumes at least one byte per unit, so this also catches bogus array/map counts before they reach
+// make(), not just string lengths before slicing.
+func boundedLength(length uint64, remaining int) (int, error) {
+	if remaining < 0 || length > uint64(remaining) {
+		return 0, fmt.Errorf("length %d exceeds %d remaining bytes", length, remaining)
+	}
+	return int(length), nil
+}
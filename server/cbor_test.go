@@ -0,0 +1,81 @@
+package server
+
+import "testing"
+
+// TestDecodeCBOROversizedLength guards against a length field that claims
+// far more data than is actually present, which used to overflow the
+// headerLen+int(length) cast to a negative int and panic on a negative
+// slice index instead of returning an error.
+func TestDecodeCBOROversizedLength(t *testing.T) {
+	cases := []struct {
+		name string
+		b    []byte
+	}{
+		// Major type 2 (byte string), 8-byte length of math.MaxUint64, no
+		// payload.
+		{"byte string", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		// Major type 4 (array), 8-byte length of math.MaxUint64, no
+		// elements.
+		{"array", []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		// Major type 5 (map), 8-byte length of math.MaxUint64, no entries.
+		{"map", []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(c.b); err == nil {
+				t.Fatalf("decodeCBOR(%x): expected an error, got none", c.b)
+			}
+		})
+	}
+}
+
+// TestDecodeCBORByteString is a basic sanity check that valid input still
+// decodes correctly after the bounds check was added.
+func TestDecodeCBORByteString(t *testing.T) {
+	// Major type 2, length 3, payload "abc".
+	b := []byte{0x43, 'a', 'b', 'c'}
+	v, n, err := decodeCBOR(b)
+	if err != nil {
+		t.Fatalf("decodeCBOR: %v", err)
+	}
+	if n != len(b) {
+		t.Errorf("consumed %d bytes, want %d", n, len(b))
+	}
+	got, ok := v.([]byte)
+	if !ok || string(got) != "abc" {
+		t.Errorf("decoded %#v, want []byte(\"abc\")", v)
+	}
+}
+
+// TestDecodeCBORTaggedArrayElement guards against a tagged value's consumed
+// length being reported without its tag header included, which used to
+// desync the offset for every array element parsed after it.
+func TestDecodeCBORTaggedArrayElement(t *testing.T) {
+	// Array of two elements: a tag-1-wrapped unsigned int 2, then text
+	// string "ok". If the tag's header length isn't folded into the
+	// reported consumed length, the second element is parsed starting
+	// one byte early, landing on the tagged integer's byte (0x02) instead
+	// of "ok"'s length byte.
+	b := []byte{
+		0x82,       // array, length 2
+		0xc1, 0x02, // tag 1, unsigned int 2
+		0x62, 'o', 'k', // text string "ok"
+	}
+	v, n, err := decodeCBOR(b)
+	if err != nil {
+		t.Fatalf("decodeCBOR: %v", err)
+	}
+	if n != len(b) {
+		t.Errorf("consumed %d bytes, want %d", n, len(b))
+	}
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) != 2 {
+		t.Fatalf("decoded %#v, want a 2-element array", v)
+	}
+	if arr[0] != int64(2) {
+		t.Errorf("arr[0] = %#v, want int64(2)", arr[0])
+	}
+	if s, ok := arr[1].(string); !ok || s != "ok" {
+		t.Errorf("arr[1] = %#v, want \"ok\"", arr[1])
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/coreos/dex/storage"
+)
+
+// keyCacheNegativeTTL bounds how long a storage.ErrNotFound from GetKeys is
+// cached, so a burst of requests during bootstrap (before keys have ever
+// been written) doesn't hammer storage on every request.
+const keyCacheNegativeTTL = 2 * time.Second
+
+// keyCachePrewarmLead is how far ahead of NextRotation the cache refreshes
+// itself, so the first request after rotation still hits a warm cache.
+const keyCachePrewarmLead = 5 * time.Second
+
+// keyCacheBootstrapPoll is how often the cache retries storage before it
+// has ever successfully populated, e.g. on a freshly initialized instance.
+const keyCacheBootstrapPoll = 10 * time.Second
+
+type keyCacheMetrics struct {
+	hits          prometheus.Counter
+	misses        prometheus.Counter
+	coalesced     prometheus.Counter
+	storageErrors prometheus.Counter
+}
+
+func newKeyCacheMetrics(reg *prometheus.Registry) (*keyCacheMetrics, error) {
+	m := &keyCacheMetrics{
+		hits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "key_cache_hits_total",
+			Help: "Count of GetKeys calls served from the in-memory cache.",
+		}),
+		misses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "key_cache_misses_total",
+			Help: "Count of GetKeys calls that required a storage read.",
+		}),
+		coalesced: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "key_cache_coalesced_total",
+			Help: "Count of concurrent misses coalesced onto an in-flight storage read.",
+		}),
+		storageErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "key_cache_storage_errors_total",
+			Help: "Count of storage errors encountered refreshing the key cache.",
+		}),
+	}
+	for _, c := range []prometheus.Collector{m.hits, m.misses, m.coalesced, m.storageErrors} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// newKeyCacher wraps s so that GetKeys is served from an in-memory cache
+// whenever possible: concurrent misses are coalesced with singleflight so
+// only one storage read is in flight per key generation, a short negative
+// cache avoids hammering storage while bootstrapping, and a background
+// goroutine refreshes the cache just before NextRotation so it's never cold
+// right after a rotation.
+func newKeyCacher(ctx context.Context, s storage.Storage, now func() time.Time, reg *prometheus.Registry) (storage.Storage, error) {
+	if now == nil {
+		now = time.Now
+	}
+
+	k := &keyCacher{Storage: s, now: now}
+	if reg != nil {
+		m, err := newKeyCacheMetrics(reg)
+		if err != nil {
+			return nil, err
+		}
+		k.metrics = m
+	}
+
+	go k.prewarmLoop(ctx)
+	return k, nil
+}
+
+type keyCacher struct {
+	storage.Storage
+
+	now     func() time.Time
+	metrics *keyCacheMetrics
+	group   singleflight.Group
+
+	mu            sync.Mutex
+	keys          *storage.Keys
+	negativeUntil time.Time
+}
+
+// GetKeys implements storage.Storage.
+func (k *keyCacher) GetKeys() (storage.Keys, error) {
+	k.mu.Lock()
+	keys := k.keys
+	negativeUntil := k.negativeUntil
+	k.mu.Unlock()
+
+	if keys != nil && k.now().Before(keys.NextRotation) {
+		k.incHits()
+		return *keys, nil
+	}
+	if !negativeUntil.IsZero() && k.now().Before(negativeUntil) {
+		k.incHits()
+		return storage.Keys{}, storage.ErrNotFound
+	}
+
+	k.incMisses()
+	v, err, shared := k.group.Do("keys", k.refresh)
+	if shared {
+		k.incCoalesced()
+	}
+	if err != nil {
+		return storage.Keys{}, err
+	}
+	return v.(storage.Keys), nil
+}
+
+// refresh reads storage and updates the cache. It's always called through
+// k.group so concurrent callers share a single storage read.
+func (k *keyCacher) refresh() (interface{}, error) {
+	storageKeys, err := k.Storage.GetKeys()
+	if err != nil {
+		if err == storage.ErrNotFound {
+			k.mu.Lock()
+			k.negativeUntil = k.now().Add(keyCacheNegativeTTL)
+			k.mu.Unlock()
+			return storage.Keys{}, err
+		}
+		k.incStorageErrors()
+		return storage.Keys{}, err
+	}
+
+	k.mu.Lock()
+	if k.now().Before(storageKeys.NextRotation) {
+		k.keys = &storageKeys
+	}
+	k.negativeUntil = time.Time{}
+	k.mu.Unlock()
+
+	return storageKeys, nil
+}
+
+// prewarmLoop refreshes the cache shortly before the current keys'
+// NextRotation, so the cache is never cold on the request path immediately
+// following a rotation.
+func (k *keyCacher) prewarmLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(k.nextPrewarmDelay()):
+			k.group.Do("keys", k.refresh)
+		}
+	}
+}
+
+func (k *keyCacher) nextPrewarmDelay() time.Duration {
+	k.mu.Lock()
+	keys := k.keys
+	k.mu.Unlock()
+
+	if keys == nil {
+		return keyCacheBootstrapPoll
+	}
+	if d := keys.NextRotation.Sub(k.now()) - keyCachePrewarmLead; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// incHits, incMisses, incCoalesced, and incStorageErrors each guard on
+// k.metrics being nil, which is the normal configuration when newKeyCacher
+// was called with a nil *prometheus.Registry (see rateLimitMiddleware and
+// recordConnectorReloadError for the same pattern elsewhere). Counting always happens through one of
+// these instead of touching k.metrics' fields directly, so a nil k.metrics
+// can never be dereferenced on the request path.
+func (k *keyCacher) incHits() {
+	if k.metrics != nil {
+		k.metrics.hits.Inc()
+	}
+}
+
+func (k *keyCacher) incMisses() {
+	if k.metrics != nil {
+		k.metrics.misses.Inc()
+	}
+}
+
+func (k *keyCacher) incCoalesced() {
+	if k.metrics != nil {
+		k.metrics.coalesced.Inc()
+	}
+}
+
+func (k *keyCacher) incStorageErrors() {
+	if k.metrics != nil {
+		k.metrics.storageErrors.Inc()
+	}
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/coreos/dex/storage"
+)
+
+// fakeKeysStorage implements just enough of storage.Storage to drive
+// keyCacher.GetKeys/refresh; every other method panics if called, which the
+// tests below never trigger.
+type fakeKeysStorage struct {
+	storage.Storage
+
+	keys  storage.Keys
+	err   error
+	calls int
+}
+
+func (f *fakeKeysStorage) GetKeys() (storage.Keys, error) {
+	f.calls++
+	return f.keys, f.err
+}
+
+// TestKeyCacherNilRegistry reproduces the nil-metrics configuration
+// documented on newKeyCacher: a nil *prometheus.Registry must not panic on
+// the hit or miss paths.
+func TestKeyCacherNilRegistry(t *testing.T) {
+	now := time.Now()
+	fake := &fakeKeysStorage{keys: storage.Keys{NextRotation: now.Add(time.Hour)}}
+
+	cached, err := newKeyCacher(context.Background(), fake, func() time.Time { return now }, nil)
+	if err != nil {
+		t.Fatalf("newKeyCacher: %v", err)
+	}
+
+	if _, err := cached.GetKeys(); err != nil {
+		t.Fatalf("GetKeys (miss): %v", err)
+	}
+	if _, err := cached.GetKeys(); err != nil {
+		t.Fatalf("GetKeys (hit): %v", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected a single storage read, got %d", fake.calls)
+	}
+}
+
+// TestKeyCacherNegativeCache verifies that a storage.ErrNotFound is cached
+// for keyCacheNegativeTTL instead of hitting storage on every call, and that
+// it still doesn't panic with a nil registry.
+func TestKeyCacherNegativeCache(t *testing.T) {
+	now := time.Now()
+	fake := &fakeKeysStorage{err: storage.ErrNotFound}
+
+	cached, err := newKeyCacher(context.Background(), fake, func() time.Time { return now }, nil)
+	if err != nil {
+		t.Fatalf("newKeyCacher: %v", err)
+	}
+
+	if _, err := cached.GetKeys(); err != storage.ErrNotFound {
+		t.Fatalf("GetKeys: got %v, want storage.ErrNotFound", err)
+	}
+	if _, err := cached.GetKeys(); err != storage.ErrNotFound {
+		t.Fatalf("GetKeys (negative cache hit): got %v, want storage.ErrNotFound", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected the negative cache to absorb the second call, got %d storage reads", fake.calls)
+	}
+}
@@ -0,0 +1,366 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Default cost parameters used when hashing a password for an algorithm
+// whose policy minimums are left unset.
+const (
+	defaultArgon2Memory      = 64 * 1024 // 64 MiB
+	defaultArgon2Time        = 3
+	defaultArgon2Parallelism = 2
+	defaultScryptN           = 1 << 15
+	defaultScryptR           = 8
+	defaultScryptP           = 1
+	defaultPBKDF2Iterations  = 210000
+	defaultSaltLen           = 16
+)
+
+// passwordAlgorithm identifies a supported password hashing scheme. Hashes
+// are stored using a PHC-style string (e.g. "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>")
+// except for bcrypt, which keeps its native "$2a$..." encoding.
+type passwordAlgorithm string
+
+const (
+	algBcrypt       passwordAlgorithm = "bcrypt"
+	algArgon2id     passwordAlgorithm = "argon2id"
+	algScrypt       passwordAlgorithm = "scrypt"
+	algPBKDF2SHA256 passwordAlgorithm = "pbkdf2-sha256"
+)
+
+// Argon2idParams holds the minimum cost parameters a stored Argon2id hash
+// must meet.
+type Argon2idParams struct {
+	Memory      uint32 // In KiB.
+	Time        uint32
+	Parallelism uint8
+}
+
+// ScryptParams holds the minimum cost parameters a stored scrypt hash must
+// meet.
+type ScryptParams struct {
+	N int
+	R int
+	P int
+}
+
+// PBKDF2Params holds the minimum cost parameters a stored PBKDF2-SHA256 hash
+// must meet.
+type PBKDF2Params struct {
+	Iterations int
+}
+
+// PasswordHashPolicy describes the minimum acceptable cost parameters for
+// each supported password hashing algorithm, and which algorithm newly
+// rehashed passwords should use.
+//
+// A zero-value field disables its minimum check; a zero-value
+// PasswordHashPolicy accepts any hash passwordDB knows how to verify.
+type PasswordHashPolicy struct {
+	BcryptMinCost int
+	Argon2id      Argon2idParams
+	Scrypt        ScryptParams
+	PBKDF2SHA256  PBKDF2Params
+
+	// PreferredAlgorithm is the algorithm passwordDB rehashes to after a
+	// successful login with a hash using a different (but still policy
+	// compliant) algorithm. Defaults to algArgon2id when empty.
+	PreferredAlgorithm passwordAlgorithm
+}
+
+func (p PasswordHashPolicy) preferredAlgorithm() passwordAlgorithm {
+	if p.PreferredAlgorithm == "" {
+		return algArgon2id
+	}
+	return p.PreferredAlgorithm
+}
+
+// phcHash is a parsed PHC-style hash string.
+type phcHash struct {
+	alg    passwordAlgorithm
+	params map[string]string
+	salt   []byte
+	digest []byte
+}
+
+func parsePHC(hash []byte) (phcHash, error) {
+	// $<alg>$<version>$<params>$<salt>$<digest>
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[0] != "" {
+		return phcHash{}, fmt.Errorf("malformed PHC hash")
+	}
+
+	params := map[string]string{}
+	for _, kv := range strings.Split(parts[3], ",") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return phcHash{}, fmt.Errorf("malformed PHC parameter %q", kv)
+		}
+		params[pair[0]] = pair[1]
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return phcHash{}, fmt.Errorf("decode salt: %v", err)
+	}
+	digest, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return phcHash{}, fmt.Errorf("decode digest: %v", err)
+	}
+
+	return phcHash{
+		alg:    passwordAlgorithm(parts[1]),
+		params: params,
+		salt:   salt,
+		digest: digest,
+	}, nil
+}
+
+func (h phcHash) uintParam(name string) (uint64, error) {
+	v, ok := h.params[name]
+	if !ok {
+		return 0, fmt.Errorf("missing PHC parameter %q", name)
+	}
+	return strconv.ParseUint(v, 10, 32)
+}
+
+// detectPasswordAlgorithm identifies which algorithm produced hash, without
+// fully parsing or verifying it.
+func detectPasswordAlgorithm(hash []byte) passwordAlgorithm {
+	switch {
+	case bytes.HasPrefix(hash, []byte("$argon2id$")):
+		return algArgon2id
+	case bytes.HasPrefix(hash, []byte("$scrypt$")):
+		return algScrypt
+	case bytes.HasPrefix(hash, []byte("$pbkdf2-sha256$")):
+		return algPBKDF2SHA256
+	default:
+		return algBcrypt
+	}
+}
+
+// verifyPassword reports whether password matches hash, whatever algorithm
+// produced it.
+func verifyPassword(hash []byte, password string) (bool, error) {
+	switch detectPasswordAlgorithm(hash) {
+	case algBcrypt:
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	case algArgon2id:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return false, err
+		}
+		m, err := h.uintParam("m")
+		if err != nil {
+			return false, err
+		}
+		t, err := h.uintParam("t")
+		if err != nil {
+			return false, err
+		}
+		p, err := h.uintParam("p")
+		if err != nil {
+			return false, err
+		}
+		digest := argon2.IDKey([]byte(password), h.salt, uint32(t), uint32(m), uint8(p), uint32(len(h.digest)))
+		return subtle.ConstantTimeCompare(digest, h.digest) == 1, nil
+	case algScrypt:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return false, err
+		}
+		n, err := h.uintParam("n")
+		if err != nil {
+			return false, err
+		}
+		r, err := h.uintParam("r")
+		if err != nil {
+			return false, err
+		}
+		p, err := h.uintParam("p")
+		if err != nil {
+			return false, err
+		}
+		digest, err := scrypt.Key([]byte(password), h.salt, 1<<n, int(r), int(p), len(h.digest))
+		if err != nil {
+			return false, err
+		}
+		return subtle.ConstantTimeCompare(digest, h.digest) == 1, nil
+	case algPBKDF2SHA256:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return false, err
+		}
+		iter, err := h.uintParam("i")
+		if err != nil {
+			return false, err
+		}
+		digest := pbkdf2.Key([]byte(password), h.salt, int(iter), len(h.digest), sha256.New)
+		return subtle.ConstantTimeCompare(digest, h.digest) == 1, nil
+	default:
+		return false, fmt.Errorf("unsupported password hash")
+	}
+}
+
+// checkPasswordPolicy reports whether hash meets the minimum cost
+// parameters required by policy. A zero-value policy accepts any hash
+// verifyPassword understands.
+func checkPasswordPolicy(hash []byte, policy PasswordHashPolicy) error {
+	switch detectPasswordAlgorithm(hash) {
+	case algBcrypt:
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return err
+		}
+		if policy.BcryptMinCost != 0 && cost < policy.BcryptMinCost {
+			return fmt.Errorf("bcrypt cost %d below policy minimum %d", cost, policy.BcryptMinCost)
+		}
+		return nil
+	case algArgon2id:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return err
+		}
+		m, _ := h.uintParam("m")
+		t, _ := h.uintParam("t")
+		p, _ := h.uintParam("p")
+		min := policy.Argon2id
+		if min.Memory != 0 && uint32(m) < min.Memory {
+			return fmt.Errorf("argon2id memory %d below policy minimum %d", m, min.Memory)
+		}
+		if min.Time != 0 && uint32(t) < min.Time {
+			return fmt.Errorf("argon2id time %d below policy minimum %d", t, min.Time)
+		}
+		if min.Parallelism != 0 && uint8(p) < min.Parallelism {
+			return fmt.Errorf("argon2id parallelism %d below policy minimum %d", p, min.Parallelism)
+		}
+		return nil
+	case algScrypt:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return err
+		}
+		n, _ := h.uintParam("n")
+		r, _ := h.uintParam("r")
+		p, _ := h.uintParam("p")
+		min := policy.Scrypt
+		if min.N != 0 && (1<<n) < min.N {
+			return fmt.Errorf("scrypt N %d below policy minimum %d", 1<<n, min.N)
+		}
+		if min.R != 0 && int(r) < min.R {
+			return fmt.Errorf("scrypt r %d below policy minimum %d", r, min.R)
+		}
+		if min.P != 0 && int(p) < min.P {
+			return fmt.Errorf("scrypt p %d below policy minimum %d", p, min.P)
+		}
+		return nil
+	case algPBKDF2SHA256:
+		h, err := parsePHC(hash)
+		if err != nil {
+			return err
+		}
+		iter, _ := h.uintParam("i")
+		if policy.PBKDF2SHA256.Iterations != 0 && int(iter) < policy.PBKDF2SHA256.Iterations {
+			return fmt.Errorf("pbkdf2-sha256 iterations %d below policy minimum %d", iter, policy.PBKDF2SHA256.Iterations)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported password hash")
+	}
+}
+
+// needsRehash reports whether hash should be replaced with one produced
+// using policy's preferred algorithm, because it uses a different
+// algorithm entirely.
+func needsRehash(hash []byte, policy PasswordHashPolicy) bool {
+	return detectPasswordAlgorithm(hash) != policy.preferredAlgorithm()
+}
+
+// encodePHC formats a PHC-style hash string: $<alg>$<version>$<params>$<salt>$<digest>.
+// version and params must not themselves contain "$"; parsePHC relies on the
+// string splitting into exactly six "$"-delimited fields.
+func encodePHC(alg passwordAlgorithm, version, params string, salt, digest []byte) []byte {
+	return []byte(fmt.Sprintf("$%s$%s$%s$%s$%s", alg, version, params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(digest)))
+}
+
+// hashPassword hashes password using policy's preferred algorithm, filling
+// in any unset cost parameters with conservative defaults.
+func hashPassword(password string, policy PasswordHashPolicy) ([]byte, error) {
+	salt := make([]byte, defaultSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %v", err)
+	}
+
+	switch policy.preferredAlgorithm() {
+	case algArgon2id:
+		mem, t, p := policy.Argon2id.Memory, policy.Argon2id.Time, policy.Argon2id.Parallelism
+		if mem == 0 {
+			mem = defaultArgon2Memory
+		}
+		if t == 0 {
+			t = defaultArgon2Time
+		}
+		if p == 0 {
+			p = defaultArgon2Parallelism
+		}
+		digest := argon2.IDKey([]byte(password), salt, t, mem, p, 32)
+		params := fmt.Sprintf("m=%d,t=%d,p=%d", mem, t, p)
+		return encodePHC(algArgon2id, "v=19", params, salt, digest), nil
+	case algScrypt:
+		n, r, p := policy.Scrypt.N, policy.Scrypt.R, policy.Scrypt.P
+		if n == 0 {
+			n = defaultScryptN
+		}
+		if r == 0 {
+			r = defaultScryptR
+		}
+		if p == 0 {
+			p = defaultScryptP
+		}
+		logN := 0
+		for 1<<uint(logN) < n {
+			logN++
+		}
+		digest, err := scrypt.Key([]byte(password), salt, n, r, p, 32)
+		if err != nil {
+			return nil, err
+		}
+		params := fmt.Sprintf("n=%d,r=%d,p=%d", logN, r, p)
+		return encodePHC(algScrypt, "v=1", params, salt, digest), nil
+	case algPBKDF2SHA256:
+		iter := policy.PBKDF2SHA256.Iterations
+		if iter == 0 {
+			iter = defaultPBKDF2Iterations
+		}
+		digest := pbkdf2.Key([]byte(password), salt, iter, 32, sha256.New)
+		params := fmt.Sprintf("i=%d", iter)
+		return encodePHC(algPBKDF2SHA256, "v=1", params, salt, digest), nil
+	default:
+		cost := policy.BcryptMinCost
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+		return bcrypt.GenerateFromPassword([]byte(password), cost)
+	}
+}
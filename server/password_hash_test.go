@@ -0,0 +1,45 @@
+package server
+
+import "testing"
+
+// TestHashPasswordRoundTrip verifies that hashPassword's output for every
+// supported algorithm can be parsed back and verified by verifyPassword and
+// checkPasswordPolicy. This guards against encodePHC/parsePHC field-count
+// mismatches like the one that used to make every scrypt and
+// pbkdf2-sha256 hash fail to parse.
+func TestHashPasswordRoundTrip(t *testing.T) {
+	for _, alg := range []passwordAlgorithm{algArgon2id, algScrypt, algPBKDF2SHA256} {
+		alg := alg
+		t.Run(string(alg), func(t *testing.T) {
+			policy := PasswordHashPolicy{PreferredAlgorithm: alg}
+
+			hash, err := hashPassword("correct horse battery staple", policy)
+			if err != nil {
+				t.Fatalf("hashPassword: %v", err)
+			}
+			if got := detectPasswordAlgorithm(hash); got != alg {
+				t.Fatalf("detectPasswordAlgorithm: got %q, want %q", got, alg)
+			}
+
+			ok, err := verifyPassword(hash, "correct horse battery staple")
+			if err != nil {
+				t.Fatalf("verifyPassword: %v", err)
+			}
+			if !ok {
+				t.Fatalf("verifyPassword: correct password rejected")
+			}
+
+			ok, err = verifyPassword(hash, "wrong password")
+			if err != nil {
+				t.Fatalf("verifyPassword (wrong password): %v", err)
+			}
+			if ok {
+				t.Fatalf("verifyPassword: incorrect password accepted")
+			}
+
+			if err := checkPasswordPolicy(hash, PasswordHashPolicy{}); err != nil {
+				t.Fatalf("checkPasswordPolicy: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	redisv "github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter decides whether a request identified by key is allowed to
+// proceed. If it isn't, retryAfter reports how long the caller should wait
+// before trying again.
+type RateLimiter interface {
+	Allow(key string) (allowed bool, retryAfter time.Duration)
+}
+
+// RateLimitConfig configures the sustained rate and burst size allowed for a
+// single rate limited endpoint.
+type RateLimitConfig struct {
+	// QPS is the sustained number of requests per second allowed per key.
+	QPS float64
+	// Burst is the number of requests above the steady QPS rate that may be
+	// served at once. Defaults to 1 if QPS is set and Burst is zero.
+	Burst int
+}
+
+// rateLimitedEndpoints are the route names rate limiting can be applied to.
+// They're also used as the Prometheus "endpoint" label.
+const (
+	endpointToken    = "token"
+	endpointAuth     = "auth"
+	endpointCallback = "callback"
+)
+
+// rateLimitMetrics are the Prometheus counters shared by every RateLimiter
+// implementation wired into the server.
+type rateLimitMetrics struct {
+	accepted *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+}
+
+func newRateLimitMetrics(reg *prometheus.Registry) (*rateLimitMetrics, error) {
+	m := &rateLimitMetrics{
+		accepted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limit_accepted_total",
+			Help: "Count of requests allowed through the rate limiter, by endpoint.",
+		}, []string{"endpoint"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rate_limit_rejected_total",
+			Help: "Count of requests rejected by the rate limiter, by endpoint.",
+		}, []string{"endpoint"}),
+	}
+	for _, c := range []prometheus.Collector{m.accepted, m.rejected} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// rateLimitMiddleware wraps h so that requests are first checked against
+// limiter using key(r) to compute the bucket key. Requests that aren't
+// allowed get a 429 with a Retry-After header instead of reaching h.
+func rateLimitMiddleware(endpoint string, limiter RateLimiter, metrics *rateLimitMetrics, key func(r *http.Request) string, h http.HandlerFunc) http.HandlerFunc {
+	if limiter == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed, retryAfter := limiter.Allow(endpoint + ":" + key(r))
+		if !allowed {
+			if metrics != nil {
+				metrics.rejected.WithLabelValues(endpoint).Inc()
+			}
+			w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retryAfter.Seconds()))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		if metrics != nil {
+			metrics.accepted.WithLabelValues(endpoint).Inc()
+		}
+		h(w, r)
+	}
+}
+
+// rateLimitKey builds the bucket key for a request: the client's remote IP,
+// combined with the OAuth2 client_id when one was supplied, so a single
+// misbehaving client can't exhaust the budget for everyone sharing its IP.
+func rateLimitKey(r *http.Request) string {
+	ip := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = h
+	}
+	clientID, _, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.URL.Query().Get("client_id")
+	}
+	if clientID == "" {
+		return ip
+	}
+	return ip + ":" + clientID
+}
+
+// TokenBucketLimiter is an in-memory RateLimiter that keeps one token bucket
+// per key, per endpoint. It's appropriate for a single dex replica; use
+// NewRedisLimiter to share limits across a fleet.
+type TokenBucketLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+
+	configs map[string]RateLimitConfig
+	now     func() time.Time
+}
+
+// NewTokenBucketLimiter returns a RateLimiter backed by per-key, in-process
+// token buckets. configs maps endpoint name ("token", "auth", "callback") to
+// the QPS and burst allowed for that endpoint; keys absent from configs are
+// never throttled.
+func NewTokenBucketLimiter(configs map[string]RateLimitConfig) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		limiters: make(map[string]*rate.Limiter),
+		configs:  configs,
+		now:      time.Now,
+	}
+}
+
+func (t *TokenBucketLimiter) configFor(endpointKey string) (RateLimitConfig, bool) {
+	for endpoint, cfg := range t.configs {
+		if len(endpointKey) >= len(endpoint) && endpointKey[:len(endpoint)] == endpoint {
+			return cfg, true
+		}
+	}
+	return RateLimitConfig{}, false
+}
+
+// Allow implements RateLimiter.
+func (t *TokenBucketLimiter) Allow(key string) (bool, time.Duration) {
+	cfg, ok := t.configFor(key)
+	if !ok || cfg.QPS <= 0 {
+		return true, 0
+	}
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	t.mu.Lock()
+	lim, ok := t.limiters[key]
+	if !ok {
+		lim = rate.NewLimiter(rate.Limit(cfg.QPS), burst)
+		t.limiters[key] = lim
+	}
+	t.mu.Unlock()
+
+	res := lim.ReserveN(t.now(), 1)
+	if !res.OK() {
+		return false, time.Second
+	}
+	if delay := res.Delay(); delay > 0 {
+		res.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+// RedisClient is the subset of a Redis client that RedisLimiter needs to
+// implement a sliding-window rate limit. github.com/go-redis/redis's
+// *redis.Client doesn't satisfy this directly, since its Eval method returns
+// a *redis.Cmd rather than (interface{}, error); wrap it in GoRedisClient
+// first.
+type RedisClient interface {
+	Eval(script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// GoRedisClient adapts a *redis.Client from github.com/go-redis/redis to the
+// RedisClient interface, unwrapping the *redis.Cmd its Eval method returns.
+type GoRedisClient struct {
+	*redisv.Client
+}
+
+// Eval implements RedisClient.
+func (c GoRedisClient) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.Client.Eval(script, keys, args...).Result()
+}
+
+// slidingWindowScript atomically increments a counter for the current
+// one-second window and reads the previous window's count, implementing a
+// sliding-window-counter approximation in constant space. KEYS[1] is the
+// current window's counter key, KEYS[2] the previous window's. ARGV[1] is
+// the key expiry in seconds (kept to two windows so prevKey is still
+// readable for the full current window).
+const slidingWindowScript = `
+local current = redis.call("INCR", KEYS[1])
+redis.call("EXPIRE", KEYS[1], ARGV[1])
+local previous = tonumber(redis.call("GET", KEYS[2]) or "0")
+return {current, previous}
+`
+
+// RedisLimiter is a RateLimiter backed by Redis, implementing a
+// sliding-window limit so counters stay consistent across every dex replica
+// sharing the same Redis instance.
+type RedisLimiter struct {
+	client  RedisClient
+	configs map[string]RateLimitConfig
+	now     func() time.Time
+}
+
+// NewRedisLimiter returns a RateLimiter that enforces limits using a
+// sliding window stored in Redis. configs maps endpoint name to the QPS and
+// burst allowed for that endpoint, same as NewTokenBucketLimiter.
+func NewRedisLimiter(client RedisClient, configs map[string]RateLimitConfig) *RedisLimiter {
+	return &RedisLimiter{client: client, configs: configs, now: time.Now}
+}
+
+func (r *RedisLimiter) configFor(endpointKey string) (RateLimitConfig, bool) {
+	for endpoint, cfg := range r.configs {
+		if len(endpointKey) >= len(endpoint) && endpointKey[:len(endpoint)] == endpoint {
+			return cfg, true
+		}
+	}
+	return RateLimitConfig{}, false
+}
+
+// Allow implements RateLimiter.
+func (r *RedisLimiter) Allow(key string) (bool, time.Duration) {
+	cfg, ok := r.configFor(key)
+	if !ok || cfg.QPS <= 0 {
+		return true, 0
+	}
+	limit := cfg.QPS
+	burst := float64(cfg.Burst)
+	if burst <= 0 {
+		burst = 1
+	}
+
+	now := r.now()
+	curBucket := now.Unix()
+	curKey := fmt.Sprintf("dex:ratelimit:%s:%d", key, curBucket)
+	prevKey := fmt.Sprintf("dex:ratelimit:%s:%d", key, curBucket-1)
+
+	// Keep both buckets around for two seconds so prevKey is still readable
+	// for the entire lifetime of the current one-second window.
+	reply, err := r.client.Eval(slidingWindowScript, []string{curKey, prevKey}, 2)
+	if err != nil {
+		// Fail open: a Redis outage shouldn't take down authentication.
+		return true, 0
+	}
+	counts, ok := reply.([]interface{})
+	if !ok || len(counts) != 2 {
+		return true, 0
+	}
+	current := toInt64(counts[0])
+	previous := toInt64(counts[1])
+
+	// Weight the previous window by how far we are into the current one to
+	// approximate a continuous sliding window. now.Unix() only has
+	// one-second resolution, so the sub-second fraction has to come from
+	// the clock's nanosecond component instead.
+	elapsed := float64(now.Nanosecond()) / float64(time.Second)
+	estimate := float64(previous)*(1-elapsed) + float64(current)
+	if estimate > limit+burst {
+		return false, time.Second
+	}
+	return true, 0
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	default:
+		return 0
+	}
+}
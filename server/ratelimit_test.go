@@ -0,0 +1,44 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeRedisClient returns a fixed Eval reply, ignoring its arguments.
+type fakeRedisClient struct {
+	reply interface{}
+	err   error
+}
+
+func (f *fakeRedisClient) Eval(script string, keys []string, args ...interface{}) (interface{}, error) {
+	return f.reply, f.err
+}
+
+// TestRedisLimiterElapsedFraction verifies that the weight given to the
+// previous window actually varies across a one-second window instead of
+// always landing on "now % 1 == 0".
+func TestRedisLimiterElapsedFraction(t *testing.T) {
+	configs := map[string]RateLimitConfig{"auth": {QPS: 5, Burst: 0}}
+	// current=3, previous=5: weighting the previous window at nearly full
+	// strength (elapsed~0, early in the window) pushes the estimate over
+	// the limit; weighting it at nearly zero (elapsed~1, late in the
+	// window) keeps it comfortably under.
+	client := &fakeRedisClient{reply: []interface{}{int64(3), int64(5)}}
+
+	early := time.Date(2020, 1, 1, 0, 0, 0, 10*int(time.Millisecond), time.UTC)
+	limiter := NewRedisLimiter(client, configs)
+	limiter.now = func() time.Time { return early }
+	allowedEarly, _ := limiter.Allow("auth:1.2.3.4")
+
+	late := time.Date(2020, 1, 1, 0, 0, 0, 990*int(time.Millisecond), time.UTC)
+	limiter.now = func() time.Time { return late }
+	allowedLate, _ := limiter.Allow("auth:1.2.3.4")
+
+	if allowedEarly {
+		t.Errorf("expected request early in the window (elapsed~0) to be rejected, previous window weighted at nearly full strength")
+	}
+	if !allowedLate {
+		t.Errorf("expected request late in the window (elapsed~1) to be allowed, previous window weighted near zero")
+	}
+}
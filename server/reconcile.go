@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/dex/storage"
+)
+
+// ConnectorEventType identifies the kind of change a ConnectorEvent
+// describes.
+type ConnectorEventType int
+
+const (
+	// ConnectorEventPut indicates a connector was created or updated.
+	ConnectorEventPut ConnectorEventType = iota
+	// ConnectorEventDelete indicates a connector was removed.
+	ConnectorEventDelete
+)
+
+// ConnectorEvent describes a single change to a connector object, as
+// observed through a storage.Storage implementation's optional
+// ConnectorWatcher extension.
+type ConnectorEvent struct {
+	Type      ConnectorEventType
+	Connector storage.Connector
+}
+
+// ConnectorWatcher is an optional extension a storage.Storage
+// implementation may satisfy to push connector changes to the server as
+// they happen, instead of the server discovering them by polling
+// ListConnectors on a timer.
+type ConnectorWatcher interface {
+	WatchConnectors(ctx context.Context) (<-chan ConnectorEvent, error)
+}
+
+// startConnectorReconciler starts the background goroutine that keeps the
+// in-memory connector map in sync with storage. If the storage
+// implementation satisfies ConnectorWatcher, connector changes are applied
+// as events arrive; otherwise the server falls back to polling
+// ListConnectors every interval.
+func (s *Server) startConnectorReconciler(ctx context.Context, interval time.Duration) {
+	st := s.storage
+	if k, ok := st.(*keyCacher); ok {
+		// newServer wraps the configured storage in a keyCacher, whose
+		// method set doesn't carry optional extensions like ConnectorWatcher.
+		st = k.Storage
+	}
+	if watcher, ok := st.(ConnectorWatcher); ok {
+		events, err := watcher.WatchConnectors(ctx)
+		if err == nil {
+			go s.watchConnectors(ctx, events)
+			return
+		}
+		s.logger.Errorf("connector watch unavailable, falling back to polling every %s: %v", interval, err)
+	}
+	go s.pollConnectors(ctx, interval)
+}
+
+func (s *Server) watchConnectors(ctx context.Context, events <-chan ConnectorEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch ev.Type {
+			case ConnectorEventPut:
+				if _, err := s.OpenConnector(ev.Connector); err != nil {
+					s.recordConnectorReloadError()
+					s.logger.Errorf("failed to reload connector %s: %v", ev.Connector.ID, err)
+				}
+			case ConnectorEventDelete:
+				s.removeConnector(ev.Connector.ID)
+			}
+		}
+	}
+}
+
+func (s *Server) pollConnectors(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			s.reconcileConnectors()
+		}
+	}
+}
+
+// reconcileConnectors diffs storage.ListConnectors against the in-memory
+// connector map, opening connectors that are new or whose ResourceVersion
+// changed, and removing connectors storage no longer lists.
+func (s *Server) reconcileConnectors() {
+	storageConnectors, err := s.storage.ListConnectors()
+	if err != nil {
+		s.recordConnectorReloadError()
+		s.logger.Errorf("failed to list connectors for reconciliation: %v", err)
+		return
+	}
+
+	want := make(map[string]bool, len(storageConnectors))
+	for _, conn := range storageConnectors {
+		want[conn.ID] = true
+
+		cur, ok := s.connectorsSnapshot()[conn.ID]
+		if ok && cur.ResourceVersion == conn.ResourceVersion {
+			continue
+		}
+		if _, err := s.OpenConnector(conn); err != nil {
+			s.recordConnectorReloadError()
+			s.logger.Errorf("failed to reload connector %s: %v", conn.ID, err)
+		}
+	}
+
+	for id := range s.connectorsSnapshot() {
+		if !want[id] {
+			s.removeConnector(id)
+		}
+	}
+}
+
+func (s *Server) recordConnectorReloadError() {
+	if s.connectorReloadErrors != nil {
+		s.connectorReloadErrors.Inc()
+	}
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/coreos/dex/connector"
+	"github.com/coreos/dex/storage"
+)
+
+// reconcileTestConnector is a comparable connector.Connector stand-in, used
+// instead of the real connector packages (which open network clients,
+// etc.) so reconcile tests can open and reopen connectors cheaply.
+type reconcileTestConnector struct{}
+
+type reconcileTestConnectorConfig struct{}
+
+func (reconcileTestConnectorConfig) Open(id string, logger logrus.FieldLogger) (connector.Connector, error) {
+	return reconcileTestConnector{}, nil
+}
+
+const reconcileTestConnectorType = "reconcileTest"
+
+func init() {
+	ConnectorsConfig[reconcileTestConnectorType] = func() ConnectorConfig { return reconcileTestConnectorConfig{} }
+}
+
+// fakeConnectorListStorage implements just enough of storage.Storage to
+// drive reconcileConnectors: ListConnectors returns whatever was last set,
+// letting a test simulate storage changing between reconciliation passes.
+type fakeConnectorListStorage struct {
+	storage.Storage
+
+	connectors []storage.Connector
+}
+
+func (f *fakeConnectorListStorage) ListConnectors() ([]storage.Connector, error) {
+	return f.connectors, nil
+}
+
+func newReconcileTestServer(fake *fakeConnectorListStorage) *Server {
+	logger := logrus.New()
+	logger.SetOutput(new(bytes.Buffer))
+
+	s := &Server{
+		storage: fake,
+		logger:  logger,
+		audit:   noopAuditSink{},
+		now:     time.Now,
+	}
+	s.connectors.Store(make(map[string]Connector))
+	return s
+}
+
+// TestReconcileConnectorsAddsNew verifies that a connector present in
+// storage but missing from the in-memory map gets opened and published.
+func TestReconcileConnectorsAddsNew(t *testing.T) {
+	fake := &fakeConnectorListStorage{connectors: []storage.Connector{
+		{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}}
+	s := newReconcileTestServer(fake)
+
+	s.reconcileConnectors()
+
+	snap := s.connectorsSnapshot()
+	if len(snap) != 1 {
+		t.Fatalf("got %d connectors, want 1", len(snap))
+	}
+	if got := snap["a"].ResourceVersion; got != "1" {
+		t.Errorf("connector %q ResourceVersion = %q, want %q", "a", got, "1")
+	}
+}
+
+// TestReconcileConnectorsReloadsOnResourceVersionChange verifies that an
+// existing connector whose ResourceVersion changed is reopened, and that
+// one whose ResourceVersion is unchanged is left alone.
+func TestReconcileConnectorsReloadsOnResourceVersionChange(t *testing.T) {
+	fake := &fakeConnectorListStorage{connectors: []storage.Connector{
+		{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+		{ID: "b", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}}
+	s := newReconcileTestServer(fake)
+	s.reconcileConnectors()
+
+	// "a" changes, "b" doesn't.
+	fake.connectors = []storage.Connector{
+		{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "2"},
+		{ID: "b", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}
+	s.reconcileConnectors()
+
+	snap := s.connectorsSnapshot()
+	if got := snap["a"].ResourceVersion; got != "2" {
+		t.Errorf("connector %q ResourceVersion = %q, want %q", "a", got, "2")
+	}
+	if got := snap["b"].ResourceVersion; got != "1" {
+		t.Errorf("connector %q ResourceVersion = %q, want %q (unchanged)", "b", got, "1")
+	}
+}
+
+// TestReconcileConnectorsRemovesMissing verifies that a connector no longer
+// listed by storage is unpublished.
+func TestReconcileConnectorsRemovesMissing(t *testing.T) {
+	fake := &fakeConnectorListStorage{connectors: []storage.Connector{
+		{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+		{ID: "b", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}}
+	s := newReconcileTestServer(fake)
+	s.reconcileConnectors()
+
+	fake.connectors = []storage.Connector{
+		{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}
+	s.reconcileConnectors()
+
+	snap := s.connectorsSnapshot()
+	if _, ok := snap["b"]; ok {
+		t.Errorf("connector %q should have been removed, still present", "b")
+	}
+	if _, ok := snap["a"]; !ok {
+		t.Errorf("connector %q should still be present", "a")
+	}
+}
+
+// TestWatchConnectorsAppliesEvents verifies that watchConnectors applies
+// ConnectorEventPut and ConnectorEventDelete events to the in-memory
+// connector map as they arrive, and stops when its context is canceled.
+func TestWatchConnectorsAppliesEvents(t *testing.T) {
+	fake := &fakeConnectorListStorage{}
+	s := newReconcileTestServer(fake)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan ConnectorEvent)
+
+	done := make(chan struct{})
+	go func() {
+		s.watchConnectors(ctx, events)
+		close(done)
+	}()
+
+	events <- ConnectorEvent{
+		Type:      ConnectorEventPut,
+		Connector: storage.Connector{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "1"},
+	}
+	waitForConnector(t, s, "a", true)
+
+	events <- ConnectorEvent{
+		Type:      ConnectorEventPut,
+		Connector: storage.Connector{ID: "a", Type: reconcileTestConnectorType, ResourceVersion: "2"},
+	}
+	waitForConnectorVersion(t, s, "a", "2")
+
+	events <- ConnectorEvent{
+		Type:      ConnectorEventDelete,
+		Connector: storage.Connector{ID: "a"},
+	}
+	waitForConnector(t, s, "a", false)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watchConnectors did not return after its context was canceled")
+	}
+}
+
+func waitForConnector(t *testing.T, s *Server, id string, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := s.connectorsSnapshot()[id]; ok == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("connector %q presence = %v after timeout, want %v", id, !want, want)
+}
+
+func waitForConnectorVersion(t *testing.T, s *Server, id, version string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if c, ok := s.connectorsSnapshot()[id]; ok && c.ResourceVersion == version {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("connector %q did not reach ResourceVersion %q in time", id, version)
+}
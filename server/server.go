@@ -14,8 +14,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"github.com/felixge/httpsnoop"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -72,11 +70,25 @@ type Config struct {
 	// If set, the server will use this connector to handle password grants
 	PasswordConnector string
 
+	// PasswordHashPolicy configures the minimum cost parameters accepted for
+	// locally stored password hashes, and which algorithm a successful
+	// login should rehash legacy hashes to. The zero value accepts bcrypt,
+	// Argon2id, scrypt, and PBKDF2-SHA256 hashes at any cost and rehashes to
+	// Argon2id.
+	PasswordHashPolicy PasswordHashPolicy
+
 	RotateKeysAfter  time.Duration // Defaults to 6 hours.
 	IDTokensValidFor time.Duration // Defaults to 24 hours
 
 	GCFrequency time.Duration // Defaults to 5 minutes
 
+	// ConnectorReconcileFrequency controls how often the background
+	// reconciler polls storage.ListConnectors looking for connectors that
+	// were added, updated, or removed out-of-band. Defaults to 30 seconds.
+	// Ignored for storage implementations that satisfy ConnectorWatcher,
+	// which are reconciled as events arrive instead.
+	ConnectorReconcileFrequency time.Duration
+
 	// If specified, the server will use this function for determining time.
 	Now func() time.Time
 
@@ -85,6 +97,35 @@ type Config struct {
 	Logger logrus.FieldLogger
 
 	PrometheusRegistry *prometheus.Registry
+
+	// RateLimits configures the sustained QPS and burst allowed for the
+	// token, auth, and callback endpoints (see endpointToken, endpointAuth,
+	// and endpointCallback), keyed by client IP and, where available,
+	// client_id. An endpoint without an entry isn't rate limited. If
+	// RateLimiter is unset, the server builds a NewTokenBucketLimiter from
+	// this field, which is appropriate for a single dex replica.
+	RateLimits map[string]RateLimitConfig
+
+	// RateLimiter, if set, guards the token, auth, and callback endpoints
+	// against abuse instead of the in-memory limiter built from
+	// RateLimits. Requests that aren't allowed receive a 429 with a
+	// Retry-After header. Use NewRedisLimiter here to share limits across a
+	// fleet of replicas.
+	RateLimiter RateLimiter
+
+	// AuditSink, if set, receives structured events for authentication and
+	// token lifecycle activity (logins, refreshes, connector reloads).
+	// Emission is asynchronous: a slow or unavailable sink only drops
+	// events, tracked by the audit_events_dropped_total Prometheus counter,
+	// and never delays the auth path. See NewStdoutAuditSink,
+	// NewFileAuditSink, and NewWebhookAuditSink for built-in
+	// implementations.
+	AuditSink AuditSink
+
+	// WebAuthn configures WebAuthn/FIDO2 second-factor step-up for the
+	// local passwordDB connector. Leaving RPID empty disables the
+	// /webauthn/* endpoints entirely.
+	WebAuthn WebAuthnConfig
 }
 
 // WebConfig holds the server's frontend templates and asset configuration.
@@ -123,10 +164,26 @@ func value(val, defaultValue time.Duration) time.Duration {
 type Server struct {
 	issuerURL url.URL
 
-	// mutex for the connectors map.
-	mu sync.Mutex
-	// Map of connector IDs to connectors.
-	connectors map[string]Connector
+	// writeMu serializes writers that rebuild the connectors map; readers
+	// go through the atomic.Value below and never block on it.
+	writeMu sync.Mutex
+	// connectors holds a map[string]Connector, published via a copy-on-write
+	// swap so the request-path read in getConnector never takes a lock.
+	connectors atomic.Value
+
+	connectorCount        prometheus.Gauge
+	connectorReloadErrors prometheus.Counter
+
+	audit AuditSink
+
+	webauthnConfig     WebAuthnConfig
+	webauthnChallenges *webAuthnChallengeStore
+	// webauthnStepUp signs the step-up tokens passwordDB.Login issues once
+	// a password check succeeds for an account with registered WebAuthn
+	// credentials; see issueWebAuthnStepUpToken. Persisted in storage (see
+	// ensureWebAuthnStepUpSecret) rather than generated per process, so
+	// every replica behind a load balancer agrees on it.
+	webauthnStepUp []byte
 
 	storage storage.Storage
 
@@ -140,6 +197,8 @@ type Server struct {
 	// Used for password grant
 	passwordConnector string
 
+	passwordHashPolicy PasswordHashPolicy
+
 	supportedResponseTypes map[string]bool
 
 	now func() time.Time
@@ -193,18 +252,66 @@ func newServer(ctx context.Context, c Config, rotationStrategy rotationStrategy)
 		return nil, fmt.Errorf("server: failed to templates: %v", err)
 	}
 
+	keyCache, err := newKeyCacher(ctx, c.Storage, c.Now, c.PrometheusRegistry)
+	if err != nil {
+		return nil, fmt.Errorf("server: failed to start key cache: %v", err)
+	}
+
 	s := &Server{
 		issuerURL:              *issuerURL,
-		connectors:             make(map[string]Connector),
-		storage:                newKeyCacher(c.Storage, c.Now),
+		storage:                keyCache,
 		supportedResponseTypes: supported,
 		idTokensValidFor:       value(c.IDTokensValidFor, 24*time.Hour),
 		skipApproval:           c.SkipApprovalScreen,
 		now:                    c.Now,
 		templates:              templates,
 		passwordConnector:      c.PasswordConnector,
+		passwordHashPolicy:     c.PasswordHashPolicy,
 		logger:                 c.Logger,
 	}
+	s.connectors.Store(make(map[string]Connector))
+
+	if c.PrometheusRegistry != nil {
+		s.connectorCount = prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "connectors_total",
+			Help: "Number of connectors currently loaded by the server.",
+		})
+		s.connectorReloadErrors = prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "connector_reload_errors_total",
+			Help: "Count of errors encountered reconciling connectors against storage.",
+		})
+		if err := c.PrometheusRegistry.Register(s.connectorCount); err != nil {
+			return nil, fmt.Errorf("server: Failed to register Prometheus connector metrics: %v", err)
+		}
+		if err := c.PrometheusRegistry.Register(s.connectorReloadErrors); err != nil {
+			return nil, fmt.Errorf("server: Failed to register Prometheus connector metrics: %v", err)
+		}
+	}
+
+	s.audit = noopAuditSink{}
+	if c.AuditSink != nil {
+		var dropped prometheus.Counter
+		if c.PrometheusRegistry != nil {
+			dropped = prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "audit_events_dropped_total",
+				Help: "Count of audit events dropped because the configured AuditSink fell behind.",
+			})
+			if err := c.PrometheusRegistry.Register(dropped); err != nil {
+				return nil, fmt.Errorf("server: Failed to register Prometheus audit metrics: %v", err)
+			}
+		}
+		s.audit = newAsyncAuditSink(c.AuditSink, dropped, c.Logger)
+	}
+
+	s.webauthnConfig = c.WebAuthn
+	s.webauthnChallenges = newWebAuthnChallengeStore(c.Now)
+	if c.WebAuthn.enabled() {
+		webauthnStepUp, err := ensureWebAuthnStepUpSecret(c.Storage)
+		if err != nil {
+			return nil, fmt.Errorf("server: failed to establish webauthn step-up secret: %v", err)
+		}
+		s.webauthnStepUp = webauthnStepUp
+	}
 
 	// Retrieves connector objects in backend storage. This list includes the static connectors
 	// defined in the ConfigMap and dynamic connectors retrieved from the storage.
@@ -213,7 +320,7 @@ func newServer(ctx context.Context, c Config, rotationStrategy rotationStrategy)
 		return nil, fmt.Errorf("server: failed to list connector objects from storage: %v", err)
 	}
 
-	if len(storageConnectors) == 0 && len(s.connectors) == 0 {
+	if len(storageConnectors) == 0 && len(s.connectorsSnapshot()) == 0 {
 		return nil, errors.New("server: no connectors specified")
 	}
 
@@ -265,18 +372,32 @@ func newServer(ctx context.Context, c Config, rotationStrategy rotationStrategy)
 	}
 	r.NotFoundHandler = http.HandlerFunc(http.NotFound)
 
+	if c.RateLimiter == nil && len(c.RateLimits) > 0 {
+		c.RateLimiter = NewTokenBucketLimiter(c.RateLimits)
+	}
+
+	var rateLimitMetrics *rateLimitMetrics
+	if c.RateLimiter != nil && c.PrometheusRegistry != nil {
+		rateLimitMetrics, err = newRateLimitMetrics(c.PrometheusRegistry)
+		if err != nil {
+			return nil, fmt.Errorf("server: Failed to register Prometheus rate limit metrics: %v", err)
+		}
+	}
+	rateLimited := func(endpoint string, h http.HandlerFunc) http.HandlerFunc {
+		return rateLimitMiddleware(endpoint, c.RateLimiter, rateLimitMetrics, rateLimitKey, h)
+	}
+
 	discoveryHandler, err := s.discoveryHandler()
 	if err != nil {
 		return nil, err
 	}
 	handleWithCORS("/.well-known/openid-configuration", discoveryHandler)
 
-	// TODO(ericchiang): rate limit certain paths based on IP.
-	handleWithCORS("/token", s.handleToken)
+	handleWithCORS("/token", rateLimited(endpointToken, s.handleToken))
 	handleWithCORS("/keys", s.handlePublicKeys)
-	handleFunc("/auth", s.handleAuthorization)
-	handleFunc("/auth/{connector}", s.handleConnectorLogin)
-	r.HandleFunc(path.Join(issuerURL.Path, "/callback"), func(w http.ResponseWriter, r *http.Request) {
+	handleFunc("/auth", rateLimited(endpointAuth, s.handleAuthorization))
+	handleFunc("/auth/{connector}", rateLimited(endpointAuth, s.handleConnectorLogin))
+	r.HandleFunc(path.Join(issuerURL.Path, "/callback"), rateLimited(endpointCallback, func(w http.ResponseWriter, r *http.Request) {
 		// Strip the X-Remote-* headers to prevent security issues on
 		// misconfigured authproxy connector setups.
 		for key := range r.Header {
@@ -285,17 +406,19 @@ func newServer(ctx context.Context, c Config, rotationStrategy rotationStrategy)
 			}
 		}
 		s.handleConnectorCallback(w, r)
-	})
+	}))
 	// For easier connector-specific web server configuration, e.g. for the
 	// "authproxy" connector.
-	handleFunc("/callback/{connector}", s.handleConnectorCallback)
+	handleFunc("/callback/{connector}", rateLimited(endpointCallback, s.handleConnectorCallback))
 	handleFunc("/approval", s.handleApproval)
 	handleFunc("/healthz", s.handleHealth)
+	s.registerWebAuthnRoutes(handleFunc)
 	handlePrefix("/", http.FileServer(c.Web.Dir))
 	s.mux = r
 
 	s.startKeyRotation(ctx, rotationStrategy, c.Now)
 	s.startGarbageCollection(ctx, value(c.GCFrequency, 5*time.Minute), c.Now)
+	s.startConnectorReconciler(ctx, value(c.ConnectorReconcileFrequency, 30*time.Second))
 
 	return s, nil
 }
@@ -317,33 +440,124 @@ func (s *Server) absURL(pathItems ...string) string {
 	return u.String()
 }
 
-func newPasswordDB(s storage.Storage) interface {
+func newPasswordDB(s storage.Storage, policy PasswordHashPolicy, audit AuditSink, now func() time.Time, webauthnStepUp []byte) interface {
 	connector.Connector
 	connector.PasswordConnector
 } {
-	return passwordDB{s}
+	return passwordDB{s: s, hashPolicy: policy, audit: audit, now: now, webauthnStepUp: webauthnStepUp}
 }
 
 type passwordDB struct {
-	s storage.Storage
+	s          storage.Storage
+	hashPolicy PasswordHashPolicy
+	audit      AuditSink
+	now        func() time.Time
+
+	// webauthnStepUp signs step-up tokens issued by Login; see
+	// issueWebAuthnStepUpToken. Empty disables the WebAuthn step-up
+	// requirement entirely, same as leaving Config.WebAuthn unset.
+	webauthnStepUp []byte
+}
+
+// WebAuthnStepUpRequiredError is returned by passwordDB.Login in place of a
+// successful login when email has WebAuthn credentials registered and the
+// request context doesn't carry proof (see ContextWithWebAuthnProof) that a
+// login ceremony already completed. Token is a short-lived, HMAC-signed
+// proof that the password check just above succeeded, and is what
+// /webauthn/login/begin requires instead of trusting a bare email.
+//
+// The caller is expected to drive the user through /webauthn/login/begin
+// and /webauthn/login/finish using Token, then retry Login with
+// ContextWithWebAuthnProof(ctx, email) set, and on success surface "hwk"
+// alongside "pwd" in the resulting ID token's amr claim. That retry and the
+// token minting live where ID tokens are issued, outside this package's
+// current files.
+type WebAuthnStepUpRequiredError struct {
+	Token string
+}
+
+func (e *WebAuthnStepUpRequiredError) Error() string { return "webauthn step-up required" }
+
+type webauthnProofContextKey struct{}
+
+// ContextWithWebAuthnProof marks ctx as carrying a successfully completed
+// WebAuthn login ceremony for email, so a subsequent passwordDB.Login call
+// for the same email doesn't issue another step-up token.
+func ContextWithWebAuthnProof(ctx context.Context, email string) context.Context {
+	return context.WithValue(ctx, webauthnProofContextKey{}, email)
+}
+
+func webauthnProofEmail(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(webauthnProofContextKey{}).(string)
+	return v, ok
+}
+
+func (db passwordDB) emitAudit(ctx context.Context, eventType, email string, success bool, errClass string) {
+	db.audit.Emit(ctx, AuditEvent{
+		Time:        db.now(),
+		Type:        eventType,
+		Subject:     email,
+		ConnectorID: LocalConnector,
+		Success:     success,
+		ErrorClass:  errClass,
+	})
 }
 
 func (db passwordDB) Login(ctx context.Context, s connector.Scopes, email, password string) (connector.Identity, bool, error) {
 	p, err := db.s.GetPassword(email)
 	if err != nil {
 		if err != storage.ErrNotFound {
+			db.emitAudit(ctx, "local.login", email, false, "storage_error")
 			return connector.Identity{}, false, fmt.Errorf("get password: %v", err)
 		}
+		db.emitAudit(ctx, "local.login", email, false, "no_such_user")
 		return connector.Identity{}, false, nil
 	}
-	// This check prevents dex users from logging in using static passwords
-	// configured with hash costs that are too high or low.
-	if err := checkCost(p.Hash); err != nil {
+	// This check prevents dex users from logging in using hashes configured
+	// with cost parameters that fall below the configured policy minimums.
+	if err := checkPasswordPolicy(p.Hash, db.hashPolicy); err != nil {
+		db.emitAudit(ctx, "local.login", email, false, "weak_hash")
 		return connector.Identity{}, false, err
 	}
-	if err := bcrypt.CompareHashAndPassword(p.Hash, []byte(password)); err != nil {
+	ok, err := verifyPassword(p.Hash, password)
+	if err != nil {
+		db.emitAudit(ctx, "local.login", email, false, "verify_error")
+		return connector.Identity{}, false, fmt.Errorf("verify password: %v", err)
+	}
+	if !ok {
+		db.emitAudit(ctx, "local.login", email, false, "invalid_credentials")
 		return connector.Identity{}, false, nil
 	}
+
+	if len(db.webauthnStepUp) > 0 {
+		creds, err := db.s.ListWebAuthnCredentials(email)
+		if err != nil {
+			db.emitAudit(ctx, "local.login", email, false, "storage_error")
+			return connector.Identity{}, false, fmt.Errorf("list webauthn credentials: %v", err)
+		}
+		if len(creds) > 0 {
+			if proven, ok := webauthnProofEmail(ctx); !ok || proven != email {
+				db.emitAudit(ctx, "local.login", email, false, "webauthn_required")
+				token := issueWebAuthnStepUpToken(db.webauthnStepUp, email, db.now())
+				return connector.Identity{}, false, &WebAuthnStepUpRequiredError{Token: token}
+			}
+		}
+	}
+
+	if needsRehash(p.Hash, db.hashPolicy) {
+		if newHash, err := hashPassword(password, db.hashPolicy); err == nil {
+			p.Hash = newHash
+			if err := db.s.UpdatePassword(email, func(old storage.Password) (storage.Password, error) {
+				old.Hash = newHash
+				return old, nil
+			}); err != nil {
+				// Non-fatal: the login already succeeded against the legacy
+				// hash. Retry the rehash on the next successful login.
+			}
+		}
+	}
+
+	db.emitAudit(ctx, "local.login", email, true, "")
 	return connector.Identity{
 		UserID:        p.UserID,
 		Username:      p.Username,
@@ -357,13 +571,16 @@ func (db passwordDB) Refresh(ctx context.Context, s connector.Scopes, identity c
 	p, err := db.s.GetPassword(identity.Email)
 	if err != nil {
 		if err == storage.ErrNotFound {
+			db.emitAudit(ctx, "local.refresh", identity.Email, false, "no_such_user")
 			return connector.Identity{}, errors.New("user not found")
 		}
+		db.emitAudit(ctx, "local.refresh", identity.Email, false, "storage_error")
 		return connector.Identity{}, fmt.Errorf("get password: %v", err)
 	}
 
 	// User removed but a new user with the same email exists.
 	if p.UserID != identity.UserID {
+		db.emitAudit(ctx, "local.refresh", identity.Email, false, "no_such_user")
 		return connector.Identity{}, errors.New("user not found")
 	}
 
@@ -374,6 +591,7 @@ func (db passwordDB) Refresh(ctx context.Context, s connector.Scopes, identity c
 	// as an ID and this implementation doesn't deal with groups.
 	identity.Username = p.Username
 
+	db.emitAudit(ctx, "local.refresh", identity.Email, true, "")
 	return identity, nil
 }
 
@@ -381,38 +599,6 @@ func (db passwordDB) Prompt() string {
 	return "Email Address"
 }
 
-// newKeyCacher returns a storage which caches keys so long as the next
-func newKeyCacher(s storage.Storage, now func() time.Time) storage.Storage {
-	if now == nil {
-		now = time.Now
-	}
-	return &keyCacher{Storage: s, now: now}
-}
-
-type keyCacher struct {
-	storage.Storage
-
-	now  func() time.Time
-	keys atomic.Value // Always holds nil or type *storage.Keys.
-}
-
-func (k *keyCacher) GetKeys() (storage.Keys, error) {
-	keys, ok := k.keys.Load().(*storage.Keys)
-	if ok && keys != nil && k.now().Before(keys.NextRotation) {
-		return *keys, nil
-	}
-
-	storageKeys, err := k.Storage.GetKeys()
-	if err != nil {
-		return storageKeys, err
-	}
-
-	if k.now().Before(storageKeys.NextRotation) {
-		k.keys.Store(&storageKeys)
-	}
-	return storageKeys, nil
-}
-
 func (s *Server) startGarbageCollection(ctx context.Context, frequency time.Duration, now func() time.Time) {
 	go func() {
 		for {
@@ -481,53 +667,136 @@ func openConnector(logger logrus.FieldLogger, conn storage.Connector) (connector
 }
 
 // OpenConnector updates server connector map with specified connector object.
+// If a connector already exists for conn.ID and implements connectorCloser,
+// it's closed once the new connector has been published.
 func (s *Server) OpenConnector(conn storage.Connector) (Connector, error) {
 	var c connector.Connector
 
 	if conn.Type == LocalConnector {
-		c = newPasswordDB(s.storage)
+		c = newPasswordDB(s.storage, s.passwordHashPolicy, s.audit, s.now, s.webauthnStepUp)
 	} else {
 		var err error
 		c, err = openConnector(s.logger.WithField("connector", conn.Name), conn)
 		if err != nil {
+			s.emitAudit(context.Background(), AuditEvent{
+				Type:        "connector.open",
+				ConnectorID: conn.ID,
+				Success:     false,
+				ErrorClass:  "open_error",
+			})
 			return Connector{}, fmt.Errorf("failed to open connector: %v", err)
 		}
 	}
 
-	connector := Connector{
+	newConn := Connector{
 		ResourceVersion: conn.ResourceVersion,
 		Connector:       c,
 	}
-	s.mu.Lock()
-	s.connectors[conn.ID] = connector
-	s.mu.Unlock()
 
-	return connector, nil
+	old, hadOld := s.swapConnector(conn.ID, newConn)
+	if hadOld {
+		closeConnector(s.logger, conn.ID, old.Connector)
+	}
+	s.recordConnectorCount()
+	s.emitAudit(context.Background(), AuditEvent{
+		Type:        "connector.open",
+		ConnectorID: conn.ID,
+		Success:     true,
+	})
+
+	return newConn, nil
 }
 
-// getConnector retrieves the connector object with the given id from the storage
-// and updates the connector list for server if necessary.
-func (s *Server) getConnector(id string) (Connector, error) {
-	storageConnector, err := s.storage.GetConnector(id)
-	if err != nil {
-		return Connector{}, fmt.Errorf("failed to get connector object from storage: %v", err)
+// connectorsSnapshot returns the map of connectors currently published.
+// Callers must treat the returned map as read-only.
+func (s *Server) connectorsSnapshot() map[string]Connector {
+	m, _ := s.connectors.Load().(map[string]Connector)
+	return m
+}
+
+// Connectors returns a snapshot of the connectors currently registered with
+// the server, keyed by connector ID.
+func (s *Server) Connectors() map[string]Connector {
+	snap := s.connectorsSnapshot()
+	out := make(map[string]Connector, len(snap))
+	for k, v := range snap {
+		out[k] = v
 	}
+	return out
+}
 
-	var conn Connector
-	var ok bool
-	s.mu.Lock()
-	conn, ok = s.connectors[id]
-	s.mu.Unlock()
+// swapConnector publishes conn under id via a copy-on-write swap of the
+// connectors map, serialized by writeMu. It returns the connector
+// previously registered under id, if any.
+func (s *Server) swapConnector(id string, conn Connector) (old Connector, hadOld bool) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
 
-	if !ok || storageConnector.ResourceVersion != conn.ResourceVersion {
-		// Connector object does not exist in server connectors map or
-		// has been updated in the storage. Need to get latest.
-		conn, err := s.OpenConnector(storageConnector)
-		if err != nil {
-			return Connector{}, fmt.Errorf("failed to open connector: %v", err)
+	cur := s.connectorsSnapshot()
+	old, hadOld = cur[id]
+
+	next := make(map[string]Connector, len(cur)+1)
+	for k, v := range cur {
+		next[k] = v
+	}
+	next[id] = conn
+	s.connectors.Store(next)
+	return old, hadOld
+}
+
+// removeConnector unpublishes the connector registered under id, if any,
+// closing it if it implements connectorCloser.
+func (s *Server) removeConnector(id string) {
+	s.writeMu.Lock()
+	cur := s.connectorsSnapshot()
+	old, hadOld := cur[id]
+	if hadOld {
+		next := make(map[string]Connector, len(cur))
+		for k, v := range cur {
+			if k != id {
+				next[k] = v
+			}
 		}
-		return conn, nil
+		s.connectors.Store(next)
+	}
+	s.writeMu.Unlock()
+
+	if hadOld {
+		closeConnector(s.logger, id, old.Connector)
+		s.recordConnectorCount()
+	}
+}
+
+func (s *Server) recordConnectorCount() {
+	if s.connectorCount != nil {
+		s.connectorCount.Set(float64(len(s.connectorsSnapshot())))
 	}
+}
 
+// connectorCloser is implemented by connectors that hold resources (open
+// connections, background goroutines, watches) that must be released when
+// the connector is removed or replaced with a new instance.
+type connectorCloser interface {
+	Close() error
+}
+
+func closeConnector(logger logrus.FieldLogger, id string, c connector.Connector) {
+	closer, ok := c.(connectorCloser)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		logger.Errorf("failed to close connector %s: %v", id, err)
+	}
+}
+
+// getConnector retrieves the connector object with the given id from the
+// in-memory snapshot kept fresh by the background reconciler (see
+// reconcile.go), without touching storage on the request path.
+func (s *Server) getConnector(id string) (Connector, error) {
+	conn, ok := s.connectorsSnapshot()[id]
+	if !ok {
+		return Connector{}, fmt.Errorf("failed to get connector object: no such connector %q", id)
+	}
 	return conn, nil
 }
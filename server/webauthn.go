@@ -0,0 +1,724 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/dex/storage"
+)
+
+// WebAuthnConfig configures the server's WebAuthn/FIDO2 second-factor
+// ceremonies for the local passwordDB connector.
+type WebAuthnConfig struct {
+	// RPID is the WebAuthn Relying Party ID, normally the host portion of
+	// the issuer URL (e.g. "dex.example.com").
+	RPID string
+	// RPDisplayName is shown to the user by their authenticator/browser
+	// during registration.
+	RPDisplayName string
+	// Origins lists the exact origins (scheme://host[:port]) a WebAuthn
+	// ceremony's clientDataJSON is allowed to report.
+	Origins []string
+	// RequireUserVerification, if true, rejects ceremonies where the
+	// authenticator didn't perform user verification (PIN, biometric),
+	// not just user presence (a touch).
+	RequireUserVerification bool
+	// ChallengeTimeout bounds how long a begin challenge stays valid.
+	// Defaults to 60 seconds.
+	ChallengeTimeout time.Duration
+}
+
+func (c WebAuthnConfig) enabled() bool { return c.RPID != "" }
+
+func (c WebAuthnConfig) timeout() time.Duration {
+	return value(c.ChallengeTimeout, 60*time.Second)
+}
+
+// webAuthnFlow distinguishes a registration ceremony from a login
+// (assertion) ceremony; both share a challenge store.
+type webAuthnFlow int
+
+const (
+	webAuthnFlowRegister webAuthnFlow = iota
+	webAuthnFlowLogin
+)
+
+type webAuthnChallenge struct {
+	challenge []byte
+	email     string
+	flow      webAuthnFlow
+	expires   time.Time
+}
+
+// webAuthnChallengeStore holds in-flight WebAuthn challenges between the
+// "begin" and "finish" calls of a ceremony. Entries are removed once
+// consumed or once they expire.
+type webAuthnChallengeStore struct {
+	mu      sync.Mutex
+	entries map[string]webAuthnChallenge
+	now     func() time.Time
+}
+
+func newWebAuthnChallengeStore(now func() time.Time) *webAuthnChallengeStore {
+	return &webAuthnChallengeStore{entries: make(map[string]webAuthnChallenge), now: now}
+}
+
+func (s *webAuthnChallengeStore) create(email string, flow webAuthnFlow, timeout time.Duration) (id string, challenge []byte, err error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", nil, fmt.Errorf("generate challenge id: %v", err)
+	}
+	challenge = make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", nil, fmt.Errorf("generate challenge: %v", err)
+	}
+
+	id = base64.RawURLEncoding.EncodeToString(idBytes)
+
+	s.mu.Lock()
+	s.entries[id] = webAuthnChallenge{
+		challenge: challenge,
+		email:     email,
+		flow:      flow,
+		expires:   s.now().Add(timeout),
+	}
+	s.gc()
+	s.mu.Unlock()
+
+	return id, challenge, nil
+}
+
+// consume returns and removes the challenge registered under id, failing
+// if it doesn't exist, has expired, or was issued for a different flow.
+func (s *webAuthnChallengeStore) consume(id string, flow webAuthnFlow) (webAuthnChallenge, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.entries[id]
+	delete(s.entries, id)
+	if !ok {
+		return webAuthnChallenge{}, fmt.Errorf("unknown or already used challenge")
+	}
+	if s.now().After(c.expires) {
+		return webAuthnChallenge{}, fmt.Errorf("challenge expired")
+	}
+	if c.flow != flow {
+		return webAuthnChallenge{}, fmt.Errorf("challenge issued for a different ceremony")
+	}
+	return c, nil
+}
+
+// gc removes expired entries. Callers must hold s.mu.
+func (s *webAuthnChallengeStore) gc() {
+	now := s.now()
+	for id, c := range s.entries {
+		if now.After(c.expires) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// clientData is the subset of WebAuthn's clientDataJSON the server checks.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// Authenticator data flag bits, as defined by the WebAuthn spec.
+const (
+	authDataFlagUP byte = 1 << 0 // user present
+	authDataFlagUV byte = 1 << 2 // user verified
+	authDataFlagAT byte = 1 << 6 // attested credential data included
+)
+
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKeyX   *big.Int
+	publicKeyY   *big.Int
+	coseAlg      int64
+	raw          []byte
+}
+
+func (a authenticatorData) userPresent() bool     { return a.flags&authDataFlagUP != 0 }
+func (a authenticatorData) userVerified() bool    { return a.flags&authDataFlagUV != 0 }
+func (a authenticatorData) hasAttestedCred() bool { return a.flags&authDataFlagAT != 0 }
+
+// parseAuthenticatorData parses the fixed-layout authData structure,
+// decoding the attested credential's COSE EC2 public key with decodeCBOR
+// when present.
+func parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	if len(b) < 37 {
+		return authenticatorData{}, fmt.Errorf("authData too short")
+	}
+	a := authenticatorData{
+		rpIDHash:  append([]byte(nil), b[:32]...),
+		flags:     b[32],
+		signCount: uint32(b[33])<<24 | uint32(b[34])<<16 | uint32(b[35])<<8 | uint32(b[36]),
+		raw:       b,
+	}
+	off := 37
+	if !a.hasAttestedCred() {
+		return a, nil
+	}
+	if len(b) < off+18 {
+		return authenticatorData{}, fmt.Errorf("authData missing attested credential data")
+	}
+	a.aaguid = append([]byte(nil), b[off:off+16]...)
+	off += 16
+	credIDLen := int(b[off])<<8 | int(b[off+1])
+	off += 2
+	if len(b) < off+credIDLen {
+		return authenticatorData{}, fmt.Errorf("authData credential id overruns input")
+	}
+	a.credentialID = append([]byte(nil), b[off:off+credIDLen]...)
+	off += credIDLen
+
+	keyVal, n, err := decodeCBOR(b[off:])
+	if err != nil {
+		return authenticatorData{}, fmt.Errorf("parse credential public key: %v", err)
+	}
+	off += n
+
+	coseKey, ok := keyVal.(map[interface{}]interface{})
+	if !ok {
+		return authenticatorData{}, fmt.Errorf("credential public key is not a CBOR map")
+	}
+	// COSE_Key field labels: 1=kty, 3=alg, -1=crv, -2=x, -3=y.
+	kty, _ := coseKey[int64(1)].(int64)
+	if kty != 2 {
+		return authenticatorData{}, fmt.Errorf("unsupported COSE key type %d, only EC2 is supported", kty)
+	}
+	alg, _ := coseKey[int64(3)].(int64)
+	x, _ := coseKey[int64(-2)].([]byte)
+	y, _ := coseKey[int64(-3)].([]byte)
+	if alg != -7 || len(x) == 0 || len(y) == 0 {
+		return authenticatorData{}, fmt.Errorf("unsupported or malformed COSE EC2 key (alg=%d), only ES256 is supported", alg)
+	}
+	a.coseAlg = alg
+	a.publicKeyX = new(big.Int).SetBytes(x)
+	a.publicKeyY = new(big.Int).SetBytes(y)
+
+	return a, nil
+}
+
+func (a authenticatorData) publicKey() *ecdsa.PublicKey {
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: a.publicKeyX, Y: a.publicKeyY}
+}
+
+// verifyClientData decodes clientDataJSON and checks its type, challenge,
+// and origin against what the server expects.
+func verifyClientData(raw []byte, wantType string, wantChallenge []byte, allowedOrigins []string) (clientData, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return cd, fmt.Errorf("parse clientDataJSON: %v", err)
+	}
+	if cd.Type != wantType {
+		return cd, fmt.Errorf("unexpected ceremony type %q", cd.Type)
+	}
+	gotChallenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return cd, fmt.Errorf("decode challenge: %v", err)
+	}
+	if subtle.ConstantTimeCompare(gotChallenge, wantChallenge) != 1 {
+		return cd, fmt.Errorf("challenge mismatch")
+	}
+	originOK := false
+	for _, o := range allowedOrigins {
+		if o == cd.Origin {
+			originOK = true
+			break
+		}
+	}
+	if !originOK {
+		return cd, fmt.Errorf("origin %q is not allowed", cd.Origin)
+	}
+	return cd, nil
+}
+
+// attestationObject is the decoded "attestationObject" produced during
+// registration.
+type attestationObject struct {
+	fmt      string
+	authData authenticatorData
+	alg      int64
+	sig      []byte
+}
+
+func parseAttestationObject(raw []byte) (attestationObject, error) {
+	v, _, err := decodeCBOR(raw)
+	if err != nil {
+		return attestationObject{}, fmt.Errorf("parse attestationObject: %v", err)
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return attestationObject{}, fmt.Errorf("attestationObject is not a CBOR map")
+	}
+
+	fmtName, _ := m["fmt"].(string)
+	authDataRaw, ok := m["authData"].([]byte)
+	if !ok {
+		return attestationObject{}, fmt.Errorf("attestationObject missing authData")
+	}
+	authData, err := parseAuthenticatorData(authDataRaw)
+	if err != nil {
+		return attestationObject{}, err
+	}
+
+	ao := attestationObject{fmt: fmtName, authData: authData}
+
+	switch fmtName {
+	case "none":
+		// No attestation statement to verify.
+	case "packed":
+		stmt, _ := m["attStmt"].(map[interface{}]interface{})
+		if stmt == nil {
+			return attestationObject{}, fmt.Errorf("packed attestation missing attStmt")
+		}
+		if _, hasCert := stmt["x5c"]; hasCert {
+			return attestationObject{}, fmt.Errorf("packed attestation with a certificate chain is not supported")
+		}
+		alg, _ := stmt["alg"].(int64)
+		sig, _ := stmt["sig"].([]byte)
+		if len(sig) == 0 {
+			return attestationObject{}, fmt.Errorf("packed attestation missing signature")
+		}
+		ao.alg = alg
+		ao.sig = sig
+	default:
+		return attestationObject{}, fmt.Errorf("unsupported attestation format %q", fmtName)
+	}
+
+	return ao, nil
+}
+
+// verifyPackedSelfAttestation checks a "packed" self-attestation statement:
+// the signature must have been produced by the credential's own private
+// key over authData || clientDataHash.
+func verifyPackedSelfAttestation(ao attestationObject, clientDataHash []byte) error {
+	if ao.alg != -7 {
+		return fmt.Errorf("unsupported packed attestation algorithm %d, only ES256 is supported", ao.alg)
+	}
+	signed := append(append([]byte(nil), ao.authData.raw...), clientDataHash...)
+	return verifyES256(ao.authData.publicKey(), signed, ao.sig)
+}
+
+// verifyES256 verifies an ASN.1 DER-encoded ECDSA signature over sha256(msg).
+func verifyES256(pub *ecdsa.PublicKey, msg, sig []byte) error {
+	var ecdsaSig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &ecdsaSig); err != nil {
+		return fmt.Errorf("parse ECDSA signature: %v", err)
+	}
+	digest := sha256.Sum256(msg)
+	if !ecdsa.Verify(pub, digest[:], ecdsaSig.R, ecdsaSig.S) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// handleWebAuthnRegisterBegin issues a registration challenge for the local
+// user identified by email, re-verifying password in the request body
+// first. Registering a hardware key is a sensitive account change, so this
+// re-checks the password directly rather than trusting a bare email or
+// relying on session state this package doesn't own.
+func (s *Server) handleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		http.Error(w, "missing email or password", http.StatusBadRequest)
+		return
+	}
+	if err := s.verifyLocalPassword(req.Email, req.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	id, challenge, err := s.webauthnChallenges.create(req.Email, webAuthnFlowRegister, s.webauthnConfig.timeout())
+	if err != nil {
+		s.logger.Errorf("webauthn: failed to create registration challenge: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"challengeId": id,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"rp": map[string]string{
+			"id":   s.webauthnConfig.RPID,
+			"name": s.webauthnConfig.RPDisplayName,
+		},
+		"user": map[string]string{
+			"name": req.Email,
+		},
+	})
+}
+
+// handleWebAuthnRegisterFinish verifies a registration ceremony response
+// and, on success, stores a new storage.WebAuthnCredential for the user.
+func (s *Server) handleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeID       string `json:"challengeId"`
+		ClientDataJSON    []byte `json:"clientDataJSON"`
+		AttestationObject []byte `json:"attestationObject"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	ch, err := s.webauthnChallenges.consume(req.ChallengeID, webAuthnFlowRegister)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := verifyClientData(req.ClientDataJSON, "webauthn.create", ch.challenge, s.webauthnConfig.Origins); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ao, err := parseAttestationObject(req.AttestationObject)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := verifyRPIDHash(ao.authData.rpIDHash, s.webauthnConfig.RPID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ao.authData.userPresent() {
+		http.Error(w, "authenticator did not report user presence", http.StatusBadRequest)
+		return
+	}
+	if s.webauthnConfig.RequireUserVerification && !ao.authData.userVerified() {
+		http.Error(w, "authenticator did not perform user verification", http.StatusBadRequest)
+		return
+	}
+	if ao.fmt == "packed" {
+		clientDataHash := sha256.Sum256(req.ClientDataJSON)
+		if err := verifyPackedSelfAttestation(ao, clientDataHash[:]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	p, err := s.storage.GetPassword(ch.email)
+	if err != nil {
+		http.Error(w, "no such user", http.StatusBadRequest)
+		return
+	}
+
+	cred := storage.WebAuthnCredential{
+		UserID:       p.UserID,
+		CredentialID: ao.authData.credentialID,
+		PublicKeyX:   ao.authData.publicKeyX.Bytes(),
+		PublicKeyY:   ao.authData.publicKeyY.Bytes(),
+		SignCount:    ao.authData.signCount,
+	}
+	if err := s.storage.CreateWebAuthnCredential(cred); err != nil {
+		s.logger.Errorf("webauthn: failed to store credential: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]bool{"registered": true})
+}
+
+// handleWebAuthnLoginBegin issues a login (assertion) challenge, to be
+// presented as the second factor after a successful password check.
+//
+// It trusts a "token" query parameter rather than a bare email: token is
+// the value of WebAuthnStepUpRequiredError.Token, which passwordDB.Login
+// only issues once it has already verified the account's password. This is
+// what stops an anonymous caller from driving another user's login
+// ceremony just by knowing their email address.
+func (s *Server) handleWebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+	email, ok := verifyWebAuthnStepUpToken(s.webauthnStepUp, token, s.now())
+	if !ok {
+		http.Error(w, "invalid or expired step-up token", http.StatusUnauthorized)
+		return
+	}
+
+	creds, err := s.storage.ListWebAuthnCredentials(email)
+	if err != nil || len(creds) == 0 {
+		http.Error(w, "no registered credentials", http.StatusBadRequest)
+		return
+	}
+
+	id, challenge, err := s.webauthnChallenges.create(email, webAuthnFlowLogin, s.webauthnConfig.timeout())
+	if err != nil {
+		s.logger.Errorf("webauthn: failed to create login challenge: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	allowed := make([]string, len(creds))
+	for i, c := range creds {
+		allowed[i] = base64.RawURLEncoding.EncodeToString(c.CredentialID)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"challengeId":      id,
+		"challenge":        base64.RawURLEncoding.EncodeToString(challenge),
+		"rpId":             s.webauthnConfig.RPID,
+		"allowCredentials": allowed,
+	})
+}
+
+// handleWebAuthnLoginFinish verifies a login (assertion) ceremony and, on
+// success, reports that the caller completed the "hwk" (hardware key)
+// authentication method for ch.email.
+//
+// The caller is expected to retry passwordDB.Login with
+// ContextWithWebAuthnProof(ctx, ch.email) set once this returns
+// {"verified": true}, and to surface "amr":["pwd","hwk"] on the resulting
+// ID token; minting that token happens outside this package's current
+// files.
+func (s *Server) handleWebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeID       string `json:"challengeId"`
+		ClientDataJSON    []byte `json:"clientDataJSON"`
+		AuthenticatorData []byte `json:"authenticatorData"`
+		Signature         []byte `json:"signature"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "malformed request", http.StatusBadRequest)
+		return
+	}
+
+	ch, err := s.webauthnChallenges.consume(req.ChallengeID, webAuthnFlowLogin)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := verifyClientData(req.ClientDataJSON, "webauthn.get", ch.challenge, s.webauthnConfig.Origins); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	authData, err := parseAuthenticatorData(req.AuthenticatorData)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := verifyRPIDHash(authData.rpIDHash, s.webauthnConfig.RPID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !authData.userPresent() {
+		http.Error(w, "authenticator did not report user presence", http.StatusBadRequest)
+		return
+	}
+	if s.webauthnConfig.RequireUserVerification && !authData.userVerified() {
+		http.Error(w, "authenticator did not perform user verification", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := s.storage.ListWebAuthnCredentials(ch.email)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var matched *storage.WebAuthnCredential
+	for i := range creds {
+		if subtle.ConstantTimeCompare(creds[i].CredentialID, authData.credentialID) == 1 {
+			matched = &creds[i]
+			break
+		}
+	}
+	if matched == nil {
+		http.Error(w, "unknown credential", http.StatusBadRequest)
+		return
+	}
+	if matched.SignCount != 0 && authData.signCount != 0 && authData.signCount <= matched.SignCount {
+		http.Error(w, "signature counter did not increase, possible cloned authenticator", http.StatusBadRequest)
+		return
+	}
+
+	pub := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(matched.PublicKeyX),
+		Y:     new(big.Int).SetBytes(matched.PublicKeyY),
+	}
+	clientDataHash := sha256.Sum256(req.ClientDataJSON)
+	signed := append(append([]byte(nil), req.AuthenticatorData...), clientDataHash[:]...)
+	if err := verifyES256(pub, signed, req.Signature); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.storage.UpdateWebAuthnCredential(matched.CredentialID, func(old storage.WebAuthnCredential) (storage.WebAuthnCredential, error) {
+		old.SignCount = authData.signCount
+		return old, nil
+	}); err != nil {
+		s.logger.Errorf("webauthn: failed to persist updated sign count: %v", err)
+	}
+
+	writeJSON(w, map[string]bool{"verified": true})
+}
+
+// ensureWebAuthnStepUpSecret returns the step-up token signing secret
+// persisted in storage, generating and persisting one on first use.
+//
+// Config's doc comment says multiple servers sharing storage are expected
+// to be configured identically, which a per-process crypto/rand secret
+// breaks: a token minted by the replica that handled Login would fail
+// verifyWebAuthnStepUpToken on whichever replica a load balancer happens to
+// route the follow-up WebAuthn request to. Storing the secret alongside the
+// signing keys, the same way every replica already agrees on those, fixes
+// that.
+func ensureWebAuthnStepUpSecret(s storage.Storage) ([]byte, error) {
+	keys, err := s.GetKeys()
+	if err != nil && err != storage.ErrNotFound {
+		return nil, fmt.Errorf("get keys: %v", err)
+	}
+	if len(keys.WebAuthnStepUpSecret) > 0 {
+		return keys.WebAuthnStepUpSecret, nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate webauthn step-up secret: %v", err)
+	}
+
+	err = s.UpdateKeys(func(old storage.Keys) (storage.Keys, error) {
+		if len(old.WebAuthnStepUpSecret) > 0 {
+			// Lost a race with another replica; use what it wrote.
+			secret = old.WebAuthnStepUpSecret
+			return old, nil
+		}
+		old.WebAuthnStepUpSecret = secret
+		return old, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("persist webauthn step-up secret: %v", err)
+	}
+	return secret, nil
+}
+
+// webAuthnStepUpTTL bounds how long a step-up token minted by a successful
+// password check (see issueWebAuthnStepUpToken) stays valid for completing
+// the matching WebAuthn login ceremony.
+const webAuthnStepUpTTL = 5 * time.Minute
+
+// issueWebAuthnStepUpToken returns an opaque, HMAC-signed token proving that
+// email's password was just verified successfully. passwordDB.Login is the
+// only caller, and only after verifyPassword succeeds: the token, not the
+// bare email a caller could otherwise supply, is what
+// handleWebAuthnLoginBegin requires.
+func issueWebAuthnStepUpToken(secret []byte, email string, now time.Time) string {
+	payload := fmt.Sprintf("%s|%d", email, now.Add(webAuthnStepUpTTL).Unix())
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebAuthnStepUpToken reports whether token is a still-valid,
+// correctly signed step-up token, returning the email it was issued for.
+func verifyWebAuthnStepUpToken(secret []byte, token string, now time.Time) (email string, ok bool) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	gotMAC, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), gotMAC) {
+		return "", false
+	}
+
+	payloadParts := strings.SplitN(string(payload), "|", 2)
+	if len(payloadParts) != 2 {
+		return "", false
+	}
+	expiry, err := strconv.ParseInt(payloadParts[1], 10, 64)
+	if err != nil || now.After(time.Unix(expiry, 0)) {
+		return "", false
+	}
+	return payloadParts[0], true
+}
+
+// verifyLocalPassword checks email/password against the local passwordDB's
+// stored hash. handleWebAuthnRegisterBegin uses it to require proof of the
+// account's password before letting a caller register a new hardware key
+// against it, instead of trusting a bare email.
+func (s *Server) verifyLocalPassword(email, password string) error {
+	p, err := s.storage.GetPassword(email)
+	if err != nil {
+		return errors.New("invalid credentials")
+	}
+	if err := checkPasswordPolicy(p.Hash, s.passwordHashPolicy); err != nil {
+		return errors.New("invalid credentials")
+	}
+	ok, err := verifyPassword(p.Hash, password)
+	if err != nil || !ok {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func verifyRPIDHash(got []byte, rpID string) error {
+	want := sha256.Sum256([]byte(rpID))
+	if subtle.ConstantTimeCompare(got, want[:]) != 1 {
+		return errors.New("rpIdHash does not match the configured RP ID")
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// registerWebAuthnRoutes wires the WebAuthn ceremony endpoints, if WebAuthn
+// is configured.
+func (s *Server) registerWebAuthnRoutes(handleFunc func(string, http.HandlerFunc)) {
+	if !s.webauthnConfig.enabled() {
+		return
+	}
+	handleFunc("/webauthn/register/begin", s.handleWebAuthnRegisterBegin)
+	handleFunc("/webauthn/register/finish", s.handleWebAuthnRegisterFinish)
+	handleFunc("/webauthn/login/begin", s.handleWebAuthnLoginBegin)
+	handleFunc("/webauthn/login/finish", s.handleWebAuthnLoginFinish)
+}
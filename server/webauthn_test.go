@@ -0,0 +1,58 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/dex/storage/memory"
+)
+
+// TestWebAuthnStepUpToken verifies that a step-up token round-trips to the
+// email it was issued for, rejects tampering, and expires.
+func TestWebAuthnStepUpToken(t *testing.T) {
+	secret := []byte("super-secret-key-for-testing-only")
+	now := time.Now()
+
+	token := issueWebAuthnStepUpToken(secret, "user@example.com", now)
+
+	email, ok := verifyWebAuthnStepUpToken(secret, token, now)
+	if !ok || email != "user@example.com" {
+		t.Fatalf("verifyWebAuthnStepUpToken: got (%q, %v), want (%q, true)", email, ok, "user@example.com")
+	}
+
+	if _, ok := verifyWebAuthnStepUpToken(secret, token, now.Add(webAuthnStepUpTTL+time.Second)); ok {
+		t.Errorf("expired token was accepted")
+	}
+
+	if _, ok := verifyWebAuthnStepUpToken(secret, token+"tampered", now); ok {
+		t.Errorf("tampered token was accepted")
+	}
+
+	otherSecret := []byte("a-completely-different-secret-key")
+	if _, ok := verifyWebAuthnStepUpToken(otherSecret, token, now); ok {
+		t.Errorf("token verified against the wrong secret")
+	}
+}
+
+// TestEnsureWebAuthnStepUpSecretPersists verifies that the secret survives
+// across separate calls backed by the same storage, the way it needs to
+// across replicas sharing that storage.
+func TestEnsureWebAuthnStepUpSecretPersists(t *testing.T) {
+	s := memory.New()
+
+	first, err := ensureWebAuthnStepUpSecret(s)
+	if err != nil {
+		t.Fatalf("ensureWebAuthnStepUpSecret: %v", err)
+	}
+	if len(first) == 0 {
+		t.Fatalf("ensureWebAuthnStepUpSecret returned an empty secret")
+	}
+
+	second, err := ensureWebAuthnStepUpSecret(s)
+	if err != nil {
+		t.Fatalf("ensureWebAuthnStepUpSecret: %v", err)
+	}
+	if string(first) != string(second) {
+		t.Errorf("ensureWebAuthnStepUpSecret returned different secrets on repeated calls against the same storage")
+	}
+}
@@ -0,0 +1,141 @@
+// Package memory provides an in-memory storage.Storage implementation,
+// useful for tests and single-replica deployments that don't need state to
+// survive a restart.
+//
+// Only the subset of storage.Storage declared in this snapshot is
+// implemented here; a real SQL or etcd backend needs its own package (and
+// its own migrations/watch semantics), which isn't part of this tree.
+package memory
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/coreos/dex/storage"
+)
+
+// New returns an empty, in-memory storage.Storage.
+func New() storage.Storage {
+	return &memStorage{
+		passwords:   make(map[string]storage.Password),
+		credentials: make(map[string]storage.WebAuthnCredential),
+	}
+}
+
+type memStorage struct {
+	mu sync.Mutex
+
+	connectors  []storage.Connector
+	passwords   map[string]storage.Password
+	credentials map[string]storage.WebAuthnCredential
+	keys        storage.Keys
+}
+
+func (m *memStorage) GetPassword(email string) (storage.Password, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.passwords[email]
+	if !ok {
+		return storage.Password{}, storage.ErrNotFound
+	}
+	return p, nil
+}
+
+func (m *memStorage) UpdatePassword(email string, updater func(old storage.Password) (storage.Password, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.passwords[email]
+	if !ok {
+		return storage.ErrNotFound
+	}
+	updated, err := updater(old)
+	if err != nil {
+		return err
+	}
+	m.passwords[email] = updated
+	return nil
+}
+
+func (m *memStorage) ListConnectors() ([]storage.Connector, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]storage.Connector, len(m.connectors))
+	copy(out, m.connectors)
+	return out, nil
+}
+
+func (m *memStorage) GetKeys() (storage.Keys, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.keys, nil
+}
+
+func (m *memStorage) UpdateKeys(updater func(old storage.Keys) (storage.Keys, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	updated, err := updater(m.keys)
+	if err != nil {
+		return err
+	}
+	m.keys = updated
+	return nil
+}
+
+func (m *memStorage) GarbageCollect(now time.Time) (storage.GCResult, error) {
+	// Nothing in this in-memory implementation expires yet: auth
+	// requests and auth codes aren't modeled here.
+	return storage.GCResult{}, nil
+}
+
+func (m *memStorage) CreateWebAuthnCredential(cred storage.WebAuthnCredential) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := string(cred.CredentialID)
+	if _, ok := m.credentials[key]; ok {
+		return storage.ErrAlreadyExists
+	}
+	m.credentials[key] = cred
+	return nil
+}
+
+func (m *memStorage) ListWebAuthnCredentials(email string) ([]storage.WebAuthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.passwords[email]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	var out []storage.WebAuthnCredential
+	for _, cred := range m.credentials {
+		if cred.UserID == p.UserID {
+			out = append(out, cred)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStorage) UpdateWebAuthnCredential(credentialID []byte, updater func(old storage.WebAuthnCredential) (storage.WebAuthnCredential, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := string(credentialID)
+	old, ok := m.credentials[key]
+	if !ok || !bytes.Equal(old.CredentialID, credentialID) {
+		return storage.ErrNotFound
+	}
+	updated, err := updater(old)
+	if err != nil {
+		return err
+	}
+	m.credentials[key] = updated
+	return nil
+}
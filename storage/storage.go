@@ -0,0 +1,90 @@
+// Package storage defines the interface dex servers use to persist
+// connector configuration, local passwords, signing keys, and WebAuthn
+// credentials.
+//
+// This package only declares the subset of storage.Storage that the server
+// package in this tree actually calls; the full interface (auth requests,
+// auth codes, refresh tokens, OAuth2 clients, offline sessions, and so on)
+// lives alongside the rest of dex's server-side request handling, which
+// isn't part of this snapshot.
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Storage methods when the requested object
+// doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrAlreadyExists is returned by Storage create methods when an object
+// with the same identity already exists.
+var ErrAlreadyExists = errors.New("already exists")
+
+// Storage is the interface dex servers use to read and write persistent
+// state.
+type Storage interface {
+	GetPassword(email string) (Password, error)
+	UpdatePassword(email string, updater func(old Password) (Password, error)) error
+
+	ListConnectors() ([]Connector, error)
+
+	GetKeys() (Keys, error)
+	// UpdateKeys applies updater to the stored Keys, creating it first if
+	// it doesn't exist yet.
+	UpdateKeys(updater func(old Keys) (Keys, error)) error
+
+	GarbageCollect(now time.Time) (GCResult, error)
+
+	// CreateWebAuthnCredential stores a new WebAuthn credential for the
+	// user it belongs to.
+	CreateWebAuthnCredential(cred WebAuthnCredential) error
+	// ListWebAuthnCredentials returns every credential registered for
+	// email, in no particular order.
+	ListWebAuthnCredentials(email string) ([]WebAuthnCredential, error)
+	// UpdateWebAuthnCredential applies updater to the credential
+	// identified by credentialID, retrying on a conflicting concurrent
+	// update the same way UpdatePassword does.
+	UpdateWebAuthnCredential(credentialID []byte, updater func(old WebAuthnCredential) (WebAuthnCredential, error)) error
+}
+
+// Password is a local user account: an email, a password hash, and the
+// profile fields surfaced on the resulting connector.Identity.
+type Password struct {
+	Email    string
+	Hash     []byte
+	Username string
+	UserID   string
+}
+
+// Connector is a connector's stored configuration. ResourceVersion changes
+// every time Config is updated, which is what lets the server tell a
+// connector reload is needed without comparing the (potentially large)
+// Config blobs byte for byte.
+type Connector struct {
+	ID              string
+	Type            string
+	Name            string
+	ResourceVersion string
+	Config          []byte
+}
+
+// Keys holds the signing key set dex uses to sign ID tokens, along with the
+// time the next rotation is due.
+type Keys struct {
+	NextRotation time.Time
+
+	// WebAuthnStepUpSecret signs the step-up tokens issued between a
+	// successful password check and the WebAuthn ceremony that follows
+	// it. It's stored alongside the signing keys, rather than generated
+	// per process, so every replica behind a load balancer can verify a
+	// token minted by any other replica.
+	WebAuthnStepUpSecret []byte
+}
+
+// GCResult reports how many expired objects a GarbageCollect call removed.
+type GCResult struct {
+	AuthRequests int64
+	AuthCodes    int64
+}
@@ -0,0 +1,20 @@
+package storage
+
+// WebAuthnCredential is a single WebAuthn public key credential registered
+// by a local user, as the second factor for passwordDB logins.
+type WebAuthnCredential struct {
+	// UserID ties the credential back to the Password it was registered
+	// against.
+	UserID string
+
+	CredentialID []byte
+
+	// PublicKeyX and PublicKeyY are the coordinates of the credential's
+	// COSE EC2 (ES256) public key.
+	PublicKeyX []byte
+	PublicKeyY []byte
+
+	// SignCount is the authenticator's signature counter as of the last
+	// successful ceremony, used to detect cloned authenticators.
+	SignCount uint32
+}